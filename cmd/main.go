@@ -1,16 +1,333 @@
 package main
 
 import (
-	_ "embed"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
 
 	"gitlab.com/germandv/sermon"
+	"gitlab.com/germandv/sermon/internal/duration"
+	"gitlab.com/germandv/sermon/sermonconfig"
 )
 
-//go:embed services.toml
-var configFileContent string
+// embedded holds `cmd/services.toml` if it exists when the binary is built,
+// it's the config used when no `-config` is given.
+//
+//go:embed services*.toml
+var embedded embed.FS
+
+// defaultConfig is the config file read when no `-config` is given and none
+// was embedded.
+const defaultConfig = "services.toml"
+
+// listFlag is a flag that can be repeated or given a comma separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// configFlags are the flags to load the config, shared by every command.
+type configFlags struct {
+	path   string
+	format string
+	dir    string
+}
+
+func (c *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.path, "config", "", "path to the config file (the embedded cmd/services.toml, or ./services.toml if none was embedded, by default)")
+	fs.StringVar(&c.format, "format", "", "config format: toml, yaml or json (detected from the file extension by default)")
+	fs.StringVar(&c.dir, "config-dir", "", "directory with additional service definitions")
+}
+
+func (c *configFlags) parse() (*sermonconfig.Config, error) {
+	var configFormat sermonconfig.Format
+	if c.format != "" {
+		var err error
+		configFormat, err = sermonconfig.ParseFormat(c.format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var serviceDirs []string
+	if c.dir != "" {
+		serviceDirs = append(serviceDirs, c.dir)
+	}
+
+	if c.path == "" {
+		content, err := embedded.ReadFile(defaultConfig)
+		if err == nil {
+			return sermonconfig.ParseAs(string(content), sermonconfig.TOML, serviceDirs...)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		c.path = defaultConfig
+	}
+
+	return sermonconfig.ParseFile(c.path, configFormat, serviceDirs...)
+}
 
 func main() {
-	err := sermon.Run(configFileContent)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "digest":
+			digest(os.Args[2:])
+			return
+		case "sla":
+			sla(os.Args[2:])
+			return
+		case "silence":
+			silence(os.Args[2:])
+			return
+		case "incidents":
+			incidents(os.Args[2:])
+			return
+		case "ack":
+			ack(os.Args[2:])
+			return
+		case "serve":
+			serve(os.Args[2:])
+			return
+		}
+	}
+	check(os.Args[1:])
+}
+
+// check checks every service, it's the default command.
+func check(args []string) {
+	var cf configFlags
+	var filter sermonconfig.Filter
+
+	fs := flag.NewFlagSet("sermon", flag.ExitOnError)
+	cf.register(fs)
+	fs.Var((*listFlag)(&filter.Tags), "tag", "only check services with this tag (repeatable)")
+	fs.Var((*listFlag)(&filter.ExcludeTags), "exclude-tag", "do not check services with this tag (repeatable)")
+	fs.Var((*listFlag)(&filter.Only), "only", "only check the service with this name (repeatable)")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	config, err = config.Filter(filter)
+	if err != nil {
+		panic(err)
+	}
+
+	err = sermon.RunConfig(config)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// digest sends a summary of the check history.
+func digest(args []string) {
+	var cf configFlags
+
+	fs := flag.NewFlagSet("sermon digest", flag.ExitOnError)
+	cf.register(fs)
+	period := fs.String("period", "", "how far back the digest goes, ie: 1d or 7d (`period` in `digest` by default)")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	p := config.Digest.Period.Duration
+	if *period != "" {
+		p, err = duration.Parse(*period)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = sermon.Digest(config, p)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// sla prints the availability of every service against its SLO.
+func sla(args []string) {
+	var cf configFlags
+
+	fs := flag.NewFlagSet("sermon sla", flag.ExitOnError)
+	cf.register(fs)
+	window := fs.String("window", "", "how far back to compute availability, ie: 30d (`window` in `sla` by default)")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	w := config.SLA.Window.Duration
+	if *window != "" {
+		w, err = duration.Parse(*window)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	report, err := sermon.SLA(config, w)
+	if err != nil {
+		panic(err)
+	}
+
+	if *asJSON {
+		err = report.JSON(os.Stdout)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+	report.Log(os.Stdout)
+}
+
+// silence adds, lists or removes silences: `silence add`, `silence list` and
+// `silence remove`.
+func silence(args []string) {
+	var cf configFlags
+	var services listFlag
+
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("sermon silence "+action, flag.ExitOnError)
+	cf.register(fs)
+	fs.Var(&services, "service", "service to silence (repeatable)")
+	forDuration := fs.String("for", "1h", "how long to silence the service for, ie: 2h or 1d")
+	reason := fs.String("reason", "", "why the service is silenced")
+	id := fs.String("id", "", "ID of the silence to remove")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	switch action {
+	case "add":
+		d, err := duration.Parse(*forDuration)
+		if err != nil {
+			panic(err)
+		}
+		silences, err := sermon.Silence(config, services, d, *reason)
+		if err != nil {
+			panic(err)
+		}
+		for _, s := range silences {
+			fmt.Printf("Silenced %s until %s (%s)\n", s.Service, s.End.Format(time.RFC1123), s.ID)
+		}
+	case "list":
+		silences, err := sermon.Silences(config)
+		if err != nil {
+			panic(err)
+		}
+		for _, s := range silences {
+			fmt.Printf("%s %s until %s %s\n", s.ID, s.Service, s.End.Format(time.RFC1123), s.Reason)
+		}
+	case "remove":
+		err = sermon.Unsilence(config, *id)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Sprintf("Unknown silence command %q, use add, list or remove", action))
+	}
+}
+
+// incidents lists the open incidents, or all of them.
+func incidents(args []string) {
+	var cf configFlags
+
+	fs := flag.NewFlagSet("sermon incidents", flag.ExitOnError)
+	cf.register(fs)
+	all := fs.Bool("all", false, "list resolved incidents too")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	list, err := sermon.Incidents(config, *all)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, i := range list {
+		status := "OPEN"
+		if !i.IsOpen() {
+			status = "RESOLVED " + i.Resolved.Format(time.RFC1123)
+		} else if i.Ack != nil {
+			status = "ACKNOWLEDGED by " + i.Ack.By
+		}
+		fmt.Printf("%s %s since %s, %d failed checks, %s\n", i.ID, i.Service, i.Opened.Format(time.RFC1123), i.Attempts, status)
+	}
+}
+
+// ack acknowledges an incident, so reminders about it stop.
+func ack(args []string) {
+	var cf configFlags
+
+	fs := flag.NewFlagSet("sermon ack", flag.ExitOnError)
+	cf.register(fs)
+	id := fs.String("id", "", "ID of the incident, or name of the service with open incidents")
+	by := fs.String("by", os.Getenv("USER"), "who acknowledges the incident")
+	note := fs.String("note", "", "a note about the incident")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	incidents, err := sermon.Acknowledge(config, *id, *by, *note)
+	if err != nil {
+		panic(err)
+	}
+	for _, incident := range incidents {
+		fmt.Printf("Acknowledged incident %s of %s\n", incident.ID, incident.Service)
+	}
+}
+
+// serve runs as a daemon, serving the admin API and evaluating escalations.
+func serve(args []string) {
+	var cf configFlags
+
+	fs := flag.NewFlagSet("sermon serve", flag.ExitOnError)
+	cf.register(fs)
+	interval := fs.Duration("interval", 0, "check all services every interval, ie: 5m (not checked by default)")
+	_ = fs.Parse(args)
+
+	config, err := cf.parse()
+	if err != nil {
+		panic(err)
+	}
+
+	err = sermon.Serve(config, *interval)
 	if err != nil {
 		panic(err)
 	}
@@ -3,3 +3,5 @@ module gitlab.com/germandv/sermon
 go 1.19
 
 require github.com/BurntSushi/toml v1.2.1
+
+require gopkg.in/yaml.v3 v3.0.1
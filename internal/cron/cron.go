@@ -0,0 +1,140 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron-like schedule with minute, hour, day of month, month and
+// day of week fields. Each field is either `*`, a value, a range `a-b` or a
+// comma separated list of them, optionally with a step, ie: `*/15` or
+// `1-5/2`. Days of the week go from 0 (Sunday) to 6, 7 is Sunday too.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// As in cron, if both days of month and of week are restricted, either
+	// of them has to match.
+	domAny, dowAny bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses a cron-like schedule, ie: `0 3 * * 0` is every Sunday at 3am.
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("Invalid schedule %q, it must have 5 fields", spec)
+	}
+
+	var sets [5]uint64
+	for i, part := range parts {
+		set, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+
+	// Sunday is both 0 and 7.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return &Schedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseField parses a field into a set of bits, one per allowed value.
+func parseField(text string, f field) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(text, ",") {
+		rng, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q in %s", stepText, f.name)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			loText, hiText, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(loText)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q in %s", rng, f.name)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiText)
+				if err != nil {
+					return 0, fmt.Errorf("bad value %q in %s", rng, f.name)
+				}
+			} else if hasStep {
+				hi = f.max
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%q out of range in %s", rng, f.name)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Matches checks if the schedule matches the minute of the given time, in its
+// location.
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 ||
+		s.hour&(1<<uint(t.Hour())) == 0 ||
+		s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if !s.domAny && !s.dowAny {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Since returns the last time, within the given duration before t, the
+// schedule matched. It's the zero time if it didn't match.
+func (s *Schedule) Since(t time.Time, d time.Duration) time.Time {
+	minute := t.Truncate(time.Minute)
+	earliest := t.Add(-d)
+	for ; minute.After(earliest); minute = minute.Add(-time.Minute) {
+		if s.Matches(minute) {
+			return minute
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,137 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		spec string
+		err  string
+	}{
+		{"* * * * *", ""},
+		{"*/15 * * * *", ""},
+		{"0 1-10/2 1,15 * 1-5", ""},
+		{"0 0 * * 7", ""},
+		{"* * * *", `Invalid schedule "* * * *", it must have 5 fields`},
+		{"* * * * * *", `Invalid schedule "* * * * * *", it must have 5 fields`},
+		{"60 * * * *", `Invalid schedule "60 * * * *": "60" out of range in minute`},
+		{"* 24 * * *", `Invalid schedule "* 24 * * *": "24" out of range in hour`},
+		{"* * 0 * *", `Invalid schedule "* * 0 * *": "0" out of range in day of month`},
+		{"* * * 13 *", `Invalid schedule "* * * 13 *": "13" out of range in month`},
+		{"* * * * 8", `Invalid schedule "* * * * 8": "8" out of range in day of week`},
+		{"10-5 * * * *", `Invalid schedule "10-5 * * * *": "10-5" out of range in minute`},
+		{"*/0 * * * *", `Invalid schedule "*/0 * * * *": bad step "0" in minute`},
+		{"*/x * * * *", `Invalid schedule "*/x * * * *": bad step "x" in minute`},
+		{"a * * * *", `Invalid schedule "a * * * *": bad value "a" in minute`},
+		{"1-b * * * *", `Invalid schedule "1-b * * * *": bad value "1-b" in minute`},
+		{"1,,2 * * * *", `Invalid schedule "1,,2 * * * *": bad value "" in minute`},
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c.spec)
+		if c.err == "" && err != nil {
+			t.Errorf("%q: got error %v", c.spec, err)
+		}
+		if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("%q: got error %v, want %q", c.spec, err, c.err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// 2024-06-03 is a Monday.
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 6, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	cases := []struct {
+		spec  string
+		time  time.Time
+		match bool
+	}{
+		{"*/15 * * * *", at(3, 10, 0), true},
+		{"*/15 * * * *", at(3, 10, 45), true},
+		{"*/15 * * * *", at(3, 10, 50), false},
+		{"1-10/2 * * * *", at(3, 10, 9), true},
+		{"1-10/2 * * * *", at(3, 10, 10), false},
+		{"1-10/2 * * * *", at(3, 10, 11), false},
+		// A value with a step runs up to the end of the field.
+		{"50/5 * * * *", at(3, 10, 55), true},
+		{"0 9,17 * * *", at(3, 17, 0), true},
+		{"0 9,17 * * *", at(3, 12, 0), false},
+		{"0 0 * 6 *", at(3, 0, 0), true},
+		{"0 0 * 7 *", at(3, 0, 0), false},
+		// Sunday is both 0 and 7.
+		{"0 0 * * 0", at(2, 0, 0), true},
+		{"0 0 * * 7", at(2, 0, 0), true},
+		// Only one of the days restricted, it has to match.
+		{"0 0 * * 1", at(3, 0, 0), true},
+		{"0 0 * * 1", at(4, 0, 0), false},
+		{"0 0 4 * *", at(4, 0, 0), true},
+		{"0 0 4 * *", at(3, 0, 0), false},
+		// Both days restricted, either one matches.
+		{"0 0 15 * 1", at(3, 0, 0), true},
+		{"0 0 15 * 1", at(15, 0, 0), true},
+		{"0 0 15 * 1", at(4, 0, 0), false},
+		{"0 0 */10 * 0", at(11, 0, 0), true},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		expect.NoError(t, err)
+		if s.Matches(c.time) != c.match {
+			t.Errorf("%q at %s: want %v", c.spec, c.time, c.match)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	s, err := Parse("30 2 * * *")
+	expect.NoError(t, err)
+
+	t.Run("ReturnsLastMatch", func(t *testing.T) {
+		now := time.Date(2024, 6, 3, 3, 15, 20, 0, time.UTC)
+		expect.Equal(t, s.Since(now, time.Hour), time.Date(2024, 6, 3, 2, 30, 0, 0, time.UTC))
+		expect.Equal(t, s.Since(now, 30*time.Minute).IsZero(), true)
+	})
+
+	t.Run("MatchesCurrentMinute", func(t *testing.T) {
+		now := time.Date(2024, 6, 3, 2, 30, 59, 0, time.UTC)
+		expect.Equal(t, s.Since(now, time.Minute), time.Date(2024, 6, 3, 2, 30, 0, 0, time.UTC))
+	})
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("No time zone data: %v", err)
+	}
+
+	t.Run("SkipsMissingHourOnSpringForward", func(t *testing.T) {
+		// Clocks jump from 2:00 to 3:00 on 2024-03-10, there's no 2:30.
+		now := time.Date(2024, 3, 10, 3, 45, 0, 0, newYork)
+		expect.Equal(t, s.Since(now, 3*time.Hour).IsZero(), true)
+
+		hourly, err := Parse("30 * * * *")
+		expect.NoError(t, err)
+		last := hourly.Since(now, 3*time.Hour)
+		expect.Equal(t, last.Equal(time.Date(2024, 3, 10, 3, 30, 0, 0, newYork)), true)
+		previous := hourly.Since(last.Add(-time.Minute), 3*time.Hour)
+		expect.Equal(t, last.Sub(previous), time.Hour)
+		expect.Equal(t, previous.Hour(), 1)
+	})
+
+	t.Run("MatchesRepeatedHourOnFallBack", func(t *testing.T) {
+		// Clocks go back from 2:00 to 1:00 on 2024-11-03, 1:30 happens twice.
+		early, err := Parse("30 1 * * *")
+		expect.NoError(t, err)
+		now := time.Date(2024, 11, 3, 2, 0, 0, 0, newYork)
+		last := early.Since(now, 3*time.Hour)
+		expect.Equal(t, now.Sub(last), 30*time.Minute)
+		first := early.Since(last.Add(-time.Minute), 3*time.Hour)
+		expect.Equal(t, last.Sub(first), time.Hour)
+		expect.Equal(t, first.Hour(), 1)
+	})
+}
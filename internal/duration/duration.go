@@ -0,0 +1,33 @@
+package duration
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse parses a duration like time.ParseDuration does, and also accepts a
+// number of days as the leading unit, ie: `7d` or `1d12h`.
+func Parse(text string) (time.Duration, error) {
+	idx := strings.Index(text, "d")
+	if idx == -1 {
+		return time.ParseDuration(text)
+	}
+
+	days, err := strconv.Atoi(text[:idx])
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("time: invalid duration %q", text)
+	}
+
+	d := time.Duration(days) * 24 * time.Hour
+	if rest := text[idx+1:]; rest != "" {
+		r, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("time: invalid duration %q", text)
+		}
+		d += r
+	}
+
+	return d, nil
+}
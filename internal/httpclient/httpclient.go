@@ -5,15 +5,15 @@ import (
 )
 
 type HttpClient interface {
-	Get(url string) (*http.Response, error)
+	Do(req *http.Request) (*http.Response, error)
 }
 
 type Client struct {
 	client *http.Client
 }
 
-func (c *Client) Get(url string) (*http.Response, error) {
-	return c.client.Get(url)
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
 }
 
 func New(client *http.Client) HttpClient {
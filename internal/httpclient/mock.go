@@ -1,14 +1,24 @@
 package httpclient
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+)
 
 type MockClient struct {
 	client *http.Client
 	url    string
 }
 
-func (c *MockClient) Get(url string) (*http.Response, error) {
-	return c.client.Get(c.url)
+// Do sends the request to the mock URL, regardless of the request's URL.
+func (c *MockClient) Do(req *http.Request) (*http.Response, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = u
+	req.Host = ""
+	return c.client.Do(req)
 }
 
 func NewMock(client *http.Client, url string) HttpClient {
@@ -0,0 +1,103 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Options are the settings of the transport requests are made with.
+type Options struct {
+	// TLS is the TLS configuration, the default one if nil.
+	TLS *tls.Config
+	// Proxy is the proxy requests go through. If nil, the proxy is taken
+	// from the environment, unless NoProxy is set.
+	Proxy   *url.URL
+	NoProxy bool
+	// LocalIP is the address connections are made from, picked by the
+	// system if nil.
+	LocalIP net.IP
+	// Network restricts connections to an IP version, `tcp4` or `tcp6`, any
+	// is used if empty. As the IP version of the connection a proxy makes
+	// can't be restricted, the proxy from the environment is ignored then.
+	Network string
+	// DisableKeepAlives closes connections after every request, so none is
+	// left open.
+	DisableKeepAlives bool
+}
+
+// NewTransport creates a transport with the defaults of http.DefaultTransport
+// and the given options.
+func NewTransport(opts Options) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+
+	switch {
+	case opts.Proxy != nil:
+		transport.Proxy = http.ProxyURL(opts.Proxy)
+	case opts.NoProxy, opts.Network != "":
+		transport.Proxy = nil
+	}
+
+	if opts.LocalIP != nil || opts.Network != "" {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}
+		if opts.LocalIP != nil {
+			dialer.LocalAddr = &net.TCPAddr{IP: opts.LocalIP}
+		}
+		transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+			if opts.Network != "" {
+				network = opts.Network
+			}
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+
+	transport.DisableKeepAlives = opts.DisableKeepAlives
+	return transport
+}
+
+var (
+	sharedMu   sync.Mutex
+	transports = map[interface{}]sharedTransport{}
+)
+
+type sharedTransport struct {
+	transport *http.Transport
+	version   string
+}
+
+// Shared returns the transport shared by every client with the same key, so
+// connections are pooled and reused across requests. The first time a key is
+// used, or whenever its version changes, ie: because the certificates it uses
+// were rotated, the transport is created with the options returned by
+// newOptions, and the connections of the previous one are closed. The key
+// must be comparable.
+func Shared(key interface{}, version string, newOptions func() (Options, error)) (*http.Transport, error) {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+
+	previous, ok := transports[key]
+	if ok && previous.version == version {
+		return previous.transport, nil
+	}
+
+	opts, err := newOptions()
+	if err != nil {
+		return nil, err
+	}
+	transport := NewTransport(opts)
+	transports[key] = sharedTransport{transport, version}
+	if ok {
+		previous.transport.CloseIdleConnections()
+	}
+	return transport, nil
+}
@@ -0,0 +1,129 @@
+package interpolate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const filePrefix = "file:"
+
+// Expand replaces every `${ENV_VAR}` reference in the given text with the
+// value of the env var, and every `${file:/path/to/file}` reference with the
+// content of the file (trailing newlines are trimmed). Use `$${` to write a
+// literal `${`. It also reports whether any reference was resolved.
+//
+// Errors never include resolved values, only the names of the references.
+func Expand(text string) (string, bool, error) {
+	expanded, values, err := Resolve(text)
+	return expanded, len(values) > 0, err
+}
+
+// Resolve is Expand, returning the resolved value of every reference, by the
+// reference as written, ie: `${TOKEN}`, instead of whether any was resolved.
+func Resolve(text string) (string, map[string]string, error) {
+	if !strings.Contains(text, "${") {
+		return text, nil, nil
+	}
+
+	sb := strings.Builder{}
+	values := map[string]string{}
+	rest := text
+
+	for {
+		start := strings.Index(rest, "${")
+		if start == -1 {
+			sb.WriteString(rest)
+			break
+		}
+
+		if start > 0 && rest[start-1] == '$' {
+			sb.WriteString(rest[:start-1])
+			sb.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end == -1 {
+			return "", nil, fmt.Errorf("Unterminated reference in %q", text)
+		}
+		end += start
+
+		value, err := lookup(rest[start+2 : end])
+		if err != nil {
+			return "", nil, err
+		}
+
+		sb.WriteString(rest[:start])
+		sb.WriteString(value)
+		values[rest[start:end+1]] = value
+		rest = rest[end+1:]
+	}
+
+	return sb.String(), values, nil
+}
+
+// Rebase makes the relative paths of the `${file:...}` references in the given
+// text relative to dir. Other references, escaped and malformed ones are kept
+// as they are.
+func Rebase(text string, dir string) string {
+	if !strings.Contains(text, "${"+filePrefix) {
+		return text
+	}
+
+	sb := strings.Builder{}
+	rest := text
+
+	for {
+		start := strings.Index(rest, "${")
+		if start == -1 {
+			sb.WriteString(rest)
+			break
+		}
+
+		end := strings.Index(rest[start:], "}")
+		if end == -1 || (start > 0 && rest[start-1] == '$') {
+			sb.WriteString(rest[:start+2])
+			rest = rest[start+2:]
+			continue
+		}
+		end += start
+
+		ref := rest[start+2 : end]
+		path := strings.TrimPrefix(ref, filePrefix)
+		if path != ref && path != "" && !filepath.IsAbs(path) {
+			ref = filePrefix + filepath.Join(dir, path)
+		}
+
+		sb.WriteString(rest[:start+2])
+		sb.WriteString(ref)
+		sb.WriteString("}")
+		rest = rest[end+1:]
+	}
+
+	return sb.String()
+}
+
+// lookup resolves a single reference, either an env var name or a `file:` path.
+func lookup(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("Empty reference `${}`")
+	}
+
+	if strings.HasPrefix(ref, filePrefix) {
+		path := strings.TrimPrefix(ref, filePrefix)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Unable to read secret file %s", path)
+		}
+		return strings.TrimRight(string(content), "\r\n"), nil
+	}
+
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("Env var %s referenced in config is not set", ref)
+	}
+	return value, nil
+}
@@ -1,32 +1,169 @@
 package mailer
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net"
 	"net/smtp"
+	"os"
+	"strconv"
+	"time"
 
 	"gitlab.com/germandv/sermon/internal/secret"
 )
 
+type TLSMode string
+
+const (
+	// TLSNone sends emails over a plain connection.
+	TLSNone TLSMode = "none"
+	// TLSStartTLS upgrades the connection with STARTTLS, it fails if the
+	// server does not support it.
+	TLSStartTLS TLSMode = "starttls"
+	// TLSImplicit uses TLS from the start, usually on port 465.
+	TLSImplicit TLSMode = "implicit"
+)
+
+const dialTimeout = 30 * time.Second
+
 type Config struct {
-	Username string
-	Password secret.Secret[string]
-	Host     string
-	Port     int
+	Username           string
+	Password           secret.Secret[string]
+	Host               string
+	Port               int
+	From               string
+	TLSMode            TLSMode
+	CAFile             string
+	InsecureSkipVerify bool
 }
 
 type Mail struct {
 	To   []string
+	Cc   []string
+	Bcc  []string
 	Body []byte
 }
 
-// Send authenticates with an SMTP server and sends an email.
+// Recipients returns every address the email is delivered to, including the
+// blind carbon copies which are not part of the body.
+func (m *Mail) Recipients() []string {
+	rcpts := make([]string, 0, len(m.To)+len(m.Cc)+len(m.Bcc))
+	rcpts = append(rcpts, m.To...)
+	rcpts = append(rcpts, m.Cc...)
+	return append(rcpts, m.Bcc...)
+}
+
+// Send connects to an SMTP server and sends an email. It only authenticates
+// if a username is set, and sends the email from the `From` address, or the
+// username if there's none.
 func Send(config *Config, mail *Mail) error {
-	auth := smtp.PlainAuth("", config.Username, config.Password.Expose(), config.Host)
-	return smtp.SendMail(
-		fmt.Sprintf("%s:%d", config.Host, config.Port),
-		auth,
-		config.Username,
-		mail.To,
-		mail.Body,
-	)
+	client, err := dial(config)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if config.Username != "" {
+		auth := smtp.PlainAuth("", config.Username, config.Password.Expose(), config.Host)
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	from := config.From
+	if from == "" {
+		from = config.Username
+	}
+
+	if err = client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range mail.Recipients() {
+		if err = client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(mail.Body); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, securing the connection according to the
+// TLS mode.
+func dial(config *Config) (*smtp.Client, error) {
+	addr := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if config.TLSMode == TLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, config.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if config.TLSMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+
+	return client, nil
+}
+
+// newTLSConfig creates the TLS config to connect to the SMTP server, trusting
+// the certificates in CAFile on top of the system ones.
+func newTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.Host,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
 }
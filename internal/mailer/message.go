@@ -0,0 +1,197 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a MIME email with a plain text and an HTML version of the same
+// content, and optionally some attachments.
+type Message struct {
+	From    string
+	To      []string
+	Cc      []string
+	Subject string
+	Date    time.Time
+	// MessageID uniquely identifies the message, it's generated if empty.
+	MessageID string
+	// InReplyTo and References are threading headers, mail clients use them
+	// to group related messages together.
+	InReplyTo   string
+	References  []string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// NewMessageID generates a unique Message-ID for the given domain.
+func NewMessageID(domain string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(b), domain)
+}
+
+// Domain returns the domain of an email address.
+func Domain(address string) string {
+	if i := strings.LastIndex(address, "@"); i != -1 && i < len(address)-1 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
+
+// Bytes renders the message as a multipart/alternative MIME email, wrapped in
+// a multipart/mixed one if there are attachments.
+func (m *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = NewMessageID(Domain(m.From))
+	}
+
+	writeHeader(&buf, "From", m.From)
+	if len(m.To) > 0 {
+		writeHeader(&buf, "To", strings.Join(m.To, ", "))
+	} else {
+		// Every recipient is a blind carbon copy.
+		writeHeader(&buf, "To", "undisclosed-recipients:;")
+	}
+	if len(m.Cc) > 0 {
+		writeHeader(&buf, "Cc", strings.Join(m.Cc, ", "))
+	}
+	writeHeader(&buf, "Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "Message-ID", messageID)
+	if m.InReplyTo != "" {
+		writeHeader(&buf, "In-Reply-To", m.InReplyTo)
+	}
+	if len(m.References) > 0 {
+		writeHeader(&buf, "References", strings.Join(m.References, " "))
+	}
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	if len(m.Attachments) == 0 {
+		err := m.writeAlternative(&buf, nil)
+		return buf.Bytes(), err
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	writeHeader(&buf, "Content-Type", fmt.Sprintf("multipart/mixed; boundary=%q", mixed.Boundary()))
+	buf.WriteString("\r\n")
+
+	err := m.writeAlternative(nil, mixed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range m.Attachments {
+		err = writeAttachment(mixed, a)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = mixed.Close()
+	return buf.Bytes(), err
+}
+
+// writeAlternative writes the text and HTML parts, either straight to buf or
+// as a part of the given multipart writer.
+func (m *Message) writeAlternative(buf *bytes.Buffer, parent *multipart.Writer) error {
+	var body bytes.Buffer
+	alt := multipart.NewWriter(&body)
+	contentType := fmt.Sprintf("multipart/alternative; boundary=%q", alt.Boundary())
+
+	err := writeText(alt, "text/plain; charset=utf-8", m.Text)
+	if err != nil {
+		return err
+	}
+	err = writeText(alt, "text/html; charset=utf-8", m.HTML)
+	if err != nil {
+		return err
+	}
+	err = alt.Close()
+	if err != nil {
+		return err
+	}
+
+	if parent == nil {
+		writeHeader(buf, "Content-Type", contentType)
+		buf.WriteString("\r\n")
+		_, err = buf.Write(body.Bytes())
+		return err
+	}
+
+	part, err := parent.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(body.Bytes())
+	return err
+}
+
+// writeText writes a quoted-printable encoded text part.
+func writeText(w *multipart.Writer, contentType string, text string) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	_, err = qp.Write([]byte(text))
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeAttachment writes a base64 encoded attachment part.
+func writeAttachment(w *multipart.Writer, a Attachment) error {
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {a.ContentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+	})
+	if err != nil {
+		return err
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(a.Data)
+	for len(encoded) > 76 {
+		if _, err = fmt.Fprintf(part, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = fmt.Fprintf(part, "%s\r\n", encoded)
+	return err
+}
+
+// writeHeader writes a single header line, line breaks in the value are
+// dropped so they can't inject other headers.
+func writeHeader(buf *bytes.Buffer, key string, value string) {
+	value = strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+	fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+}
@@ -0,0 +1,156 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func newMessage() *Message {
+	return &Message{
+		From:    "sermon@me.io",
+		To:      []string{"ops@me.io", "dev@me.io"},
+		Cc:      []string{"boss@me.io"},
+		Subject: "Sermon: 1 service down ⚠",
+		Date:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		Text:    "bad.test is down",
+		HTML:    "<p>bad.test is down</p>",
+	}
+}
+
+// readMessage parses the output of Bytes, with the media type and params of
+// its body.
+func readMessage(t *testing.T, m *Message) (*mail.Message, string, map[string]string) {
+	t.Helper()
+	content, err := m.Bytes()
+	expect.NoError(t, err)
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	expect.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	expect.NoError(t, err)
+	return msg, mediaType, params
+}
+
+// readParts returns the parts of a multipart body, their content is decoded
+// from quoted-printable.
+func readParts(t *testing.T, r io.Reader, boundary string) ([]*multipart.Part, []string) {
+	t.Helper()
+	var parts []*multipart.Part
+	var contents []string
+	mr := multipart.NewReader(r, boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return parts, contents
+		}
+		expect.NoError(t, err)
+		content, err := io.ReadAll(part)
+		expect.NoError(t, err)
+		parts = append(parts, part)
+		contents = append(contents, string(content))
+	}
+}
+
+func TestMessageBytes(t *testing.T) {
+	t.Run("WritesHeaders", func(t *testing.T) {
+		m := newMessage()
+		m.MessageID = "<1.abc@me.io>"
+		msg, _, _ := readMessage(t, m)
+
+		subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		expect.NoError(t, err)
+		expect.Equal(t, subject, "Sermon: 1 service down ⚠")
+		expect.Equal(t, msg.Header.Get("From"), "sermon@me.io")
+		expect.Equal(t, msg.Header.Get("To"), "ops@me.io, dev@me.io")
+		expect.Equal(t, msg.Header.Get("Cc"), "boss@me.io")
+		expect.Equal(t, msg.Header.Get("Date"), "Mon, 01 Jan 2024 12:00:00 +0000")
+		expect.Equal(t, msg.Header.Get("Message-ID"), "<1.abc@me.io>")
+		expect.Equal(t, msg.Header.Get("MIME-Version"), "1.0")
+		expect.Equal(t, msg.Header.Get("In-Reply-To"), "")
+		expect.Equal(t, msg.Header.Get("References"), "")
+	})
+
+	t.Run("GeneratesMessageID", func(t *testing.T) {
+		msg, _, _ := readMessage(t, newMessage())
+		id := msg.Header.Get("Message-ID")
+		expect.Equal(t, strings.HasPrefix(id, "<"), true)
+		expect.Equal(t, strings.HasSuffix(id, "@me.io>"), true)
+	})
+
+	t.Run("WritesThreadingHeaders", func(t *testing.T) {
+		m := newMessage()
+		m.InReplyTo = "<2.def@me.io>"
+		m.References = []string{"<1.abc@me.io>", "<2.def@me.io>"}
+		msg, _, _ := readMessage(t, m)
+		expect.Equal(t, msg.Header.Get("In-Reply-To"), "<2.def@me.io>")
+		expect.Equal(t, msg.Header.Get("References"), "<1.abc@me.io> <2.def@me.io>")
+	})
+
+	t.Run("DropsLineBreaksInHeaders", func(t *testing.T) {
+		m := newMessage()
+		m.InReplyTo = "<2.def@me.io>\r\nBcc: eve@evil.test"
+		msg, _, _ := readMessage(t, m)
+		expect.Equal(t, msg.Header.Get("Bcc"), "")
+		expect.Equal(t, msg.Header.Get("In-Reply-To"), "<2.def@me.io>  Bcc: eve@evil.test")
+	})
+
+	t.Run("HidesBlindCarbonCopies", func(t *testing.T) {
+		m := newMessage()
+		m.To = nil
+		m.Cc = nil
+		msg, _, _ := readMessage(t, m)
+		expect.Equal(t, msg.Header.Get("To"), "undisclosed-recipients:;")
+		_, ok := msg.Header["Cc"]
+		expect.Equal(t, ok, false)
+	})
+
+	t.Run("WritesTextAndHTML", func(t *testing.T) {
+		m := newMessage()
+		m.Text = "Café " + strings.Repeat("x", 100)
+		msg, mediaType, params := readMessage(t, m)
+		expect.Equal(t, mediaType, "multipart/alternative")
+
+		parts, contents := readParts(t, msg.Body, params["boundary"])
+		expect.Equal(t, len(parts), 2)
+		expect.Equal(t, parts[0].Header.Get("Content-Type"), "text/plain; charset=utf-8")
+		expect.Equal(t, contents[0], m.Text)
+		expect.Equal(t, parts[1].Header.Get("Content-Type"), "text/html; charset=utf-8")
+		expect.Equal(t, contents[1], "<p>bad.test is down</p>")
+	})
+
+	t.Run("WritesAttachments", func(t *testing.T) {
+		m := newMessage()
+		data := bytes.Repeat([]byte("name,healthy\nbad.test,false\n"), 10)
+		m.Attachments = []Attachment{{Filename: "report.csv", ContentType: "text/csv", Data: data}}
+		msg, mediaType, params := readMessage(t, m)
+		expect.Equal(t, mediaType, "multipart/mixed")
+
+		parts, contents := readParts(t, msg.Body, params["boundary"])
+		expect.Equal(t, len(parts), 2)
+
+		altType, altParams, err := mime.ParseMediaType(parts[0].Header.Get("Content-Type"))
+		expect.NoError(t, err)
+		expect.Equal(t, altType, "multipart/alternative")
+		expect.Equal(t, altParams["boundary"] != params["boundary"], true)
+		alternatives, _ := readParts(t, strings.NewReader(contents[0]), altParams["boundary"])
+		expect.Equal(t, len(alternatives), 2)
+
+		expect.Equal(t, parts[1].Header.Get("Content-Type"), "text/csv")
+		expect.Equal(t, parts[1].Header.Get("Content-Transfer-Encoding"), "base64")
+		expect.Equal(t, parts[1].FileName(), "report.csv")
+		for _, line := range strings.Split(strings.TrimSpace(contents[1]), "\r\n") {
+			expect.Equal(t, len(line) <= 76, true)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(contents[1], "\r\n", ""))
+		expect.NoError(t, err)
+		expect.Equal(t, string(decoded), string(data))
+	})
+}
@@ -1,24 +1,166 @@
 package sermon
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/http/cookiejar"
 	"os"
+	"strings"
 	"sync"
+	"time"
 
 	"gitlab.com/germandv/sermon/internal/httpclient"
 	"gitlab.com/germandv/sermon/sermonconfig"
 	"gitlab.com/germandv/sermon/sermoncore"
 	"gitlab.com/germandv/sermon/sermonreport"
+	"gitlab.com/germandv/sermon/sermonserver"
+	"gitlab.com/germandv/sermon/sermonstate"
 )
 
+// escalationInterval is how often the daemon evaluates escalations.
+const escalationInterval = 30 * time.Second
+
 // Check verifies the health of a Service.
 func Check(s sermoncore.Service) *sermoncore.ServiceStatus {
-	client := httpclient.New(&http.Client{Timeout: s.Timeout.Duration})
-	err := s.Health(client)
+	if s.IsScenario() {
+		return CheckScenario(s)
+	}
+
+	client, err := newClient(s, nil)
+	if err != nil {
+		return newStatus(s, err)
+	}
+	start := time.Now()
+	probe, err := s.Probe(client)
+
+	ss := newStatus(s, err)
+	ss.Endpoint = s.Endpoint.String()
+	ss.Duration = time.Since(start)
+	ss.CertExpiry = probe.CertExpiry
+	ss.Timing = &probe.Timing
+	ss.Redirects = probe.Redirects
+	return ss
+}
+
+// CheckScenario verifies the health of a scenario Service by running its steps,
+// which share cookies. The timeout applies to every step.
+func CheckScenario(s sermoncore.Service) *sermoncore.ServiceStatus {
+	jar, _ := cookiejar.New(nil)
+	client, err := newClient(s, jar)
+	if err != nil {
+		return newStatus(s, err)
+	}
+	start := time.Now()
+	steps, probe, err := s.Scenario(client)
+
+	ss := newStatus(s, err)
+	ss.Duration = time.Since(start)
+	ss.CertExpiry = probe.CertExpiry
+	ss.Steps = steps
+	return ss
+}
+
+// transportKey identifies the connection settings of a Service, checks with
+// the same ones share a transport.
+type transportKey struct {
+	tls     sermoncore.TLS
+	proxy   string
+	noProxy bool
+	localIP string
+	network string
+}
+
+// newClient creates the client to check a Service with, according to its
+// settings. Unless the service doesn't reuse connections, the transport is
+// shared with the services with the same connection settings.
+func newClient(s sermoncore.Service, jar http.CookieJar) (httpclient.HttpClient, error) {
+	localIP, err := s.SourceIP()
+	if err != nil {
+		return nil, err
+	}
+
+	newOptions := func() (httpclient.Options, error) {
+		tlsConfig, err := s.TLS.Config()
+		if err != nil {
+			return httpclient.Options{}, err
+		}
+		return httpclient.Options{
+			TLS:               tlsConfig,
+			Proxy:             s.Proxy.URL,
+			NoProxy:           s.Proxy.Direct,
+			LocalIP:           localIP,
+			Network:           s.IPVersion.Network(),
+			DisableKeepAlives: !s.ReusesConnections(),
+		}, nil
+	}
+
+	var transport *http.Transport
+	if s.ReusesConnections() {
+		key := transportKey{
+			tls:     s.TLS,
+			noProxy: s.Proxy.Direct,
+			localIP: localIP.String(),
+			network: s.IPVersion.Network(),
+		}
+		if s.Proxy.URL != nil {
+			key.proxy = s.Proxy.URL.String()
+		}
+		revision, err := s.TLS.Revision()
+		if err != nil {
+			return nil, err
+		}
+		transport, err = httpclient.Shared(key, revision, newOptions)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		opts, err := newOptions()
+		if err != nil {
+			return nil, err
+		}
+		transport = httpclient.NewTransport(opts)
+	}
+
+	return httpclient.New(&http.Client{
+		Transport:     transport,
+		Timeout:       s.Timeout.Duration,
+		Jar:           jar,
+		CheckRedirect: s.CheckRedirect,
+	}), nil
+}
+
+// CheckHeartbeat verifies the health of a heartbeat Service at time t, from the
+// pings in the store, which are only read.
+func CheckHeartbeat(s sermoncore.Service, store *sermonstate.Store, t time.Time) *sermoncore.ServiceStatus {
+	heartbeat, err := store.Heartbeat(s.Name, t)
+	if err == nil {
+		err = heartbeat.Check(t, s.Period.Duration+s.Grace.Duration)
+	}
+
+	ss := newStatus(s, err)
+	ss.Duration = time.Duration(heartbeat.DurationMs) * time.Millisecond
+	return ss
+}
+
+// newStatus creates the status of a Service, healthy unless there's an error.
+func newStatus(s sermoncore.Service, err error) *sermoncore.ServiceStatus {
 	return &sermoncore.ServiceStatus{
-		Name:    s.Name,
-		Healthy: err == nil,
-		Err:     err,
+		Name:       s.Name,
+		ConfigName: s.BaseName(),
+		IPVersion:  s.IPVersion.Version,
+		Healthy:    err == nil,
+		Err:        err,
+		Tags:       s.Tags,
+		Group:      s.Group,
+		Severity:   s.Severity.String(),
+
+		Description:  s.Description,
+		Owner:        s.Owner,
+		RunbookURL:   s.RunbookURL,
+		DashboardURL: s.DashboardURL,
+		DependsOn:    s.DependsOn,
 	}
 }
 
@@ -26,39 +168,322 @@ func Check(s sermoncore.Service) *sermoncore.ServiceStatus {
 func CheckAll(config *sermonconfig.Config) *sermonreport.Report {
 	report := &sermonreport.Report{}
 	var wg sync.WaitGroup
+	now := time.Now()
 
 	for name, service := range config.Services {
-		wg.Add(1)
 		s := service
 		s.Name = name
 
-		go func() {
-			defer wg.Done()
-			checkWithRetry := withRetry(config.Attempts.Value, Check, func(ss *sermoncore.ServiceStatus) bool {
-				return !ss.Healthy
-			})
-			report.Add(checkWithRetry(s))
-		}()
+		if s.IsHeartbeat() {
+			store, err := sermonstate.Open(config.StateDir)
+			if err != nil {
+				report.Add(newStatus(s, err))
+				continue
+			}
+			report.Add(CheckHeartbeat(s, store, now))
+			continue
+		}
+
+		for _, family := range s.ByIPVersion() {
+			s := family
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				checkWithRetry := withRetry(config.Attempts.Value, Check, func(ss *sermoncore.ServiceStatus) bool {
+					return !ss.Healthy
+				})
+				report.Add(checkWithRetry(s))
+			}()
+		}
 	}
 
 	wg.Wait()
 	return report
 }
 
-// Run parses the config, checks all services and emails the results.
+// Run parses the TOML config and checks all services in it, as RunConfig
+// does.
 func Run(configFileContent string) error {
 	config, err := sermonconfig.Parse(configFileContent)
 	if err != nil {
 		return err
 	}
+	return RunConfig(config)
+}
 
+// RunConfig checks all services in the config and emails the results. If
+// there's a `state_dir`, the state of every service is tracked across runs and the
+// results are recorded in its history, incidents are opened and resolved,
+// and services with an SLO are alerted on if they use up their error budget
+// too quickly. Services in maintenance are checked and recorded, but not
+// notified about.
+func RunConfig(config *sermonconfig.Config) error {
+	_, err := run(config)
+	return err
+}
+
+// run is RunConfig, returning the Report even if notifying about it fails.
+func run(config *sermonconfig.Config) (*sermonreport.Report, error) {
+	checkedAt := time.Now()
 	report := CheckAll(config)
+
+	var store *sermonstate.Store
+	var silences []sermonstate.Silence
+	if config.StateDir != "" {
+		var err error
+		store, err = sermonstate.Open(config.StateDir)
+		if err != nil {
+			return report, err
+		}
+
+		err = track(store, config, report, checkedAt)
+		if err != nil {
+			return report, err
+		}
+
+		err = record(store, report, checkedAt)
+		if err != nil {
+			return report, err
+		}
+
+		if keep := retention(config); keep > 0 {
+			err = store.Prune(checkedAt.Add(-keep))
+			if err != nil {
+				return report, err
+			}
+		}
+
+		silences, err = store.Silences(checkedAt)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	maintain(config, silences, report, checkedAt)
+	report.FoldDependencies()
+
+	if store != nil {
+		err := trackIncidents(store, report, checkedAt)
+		if err != nil {
+			return report, err
+		}
+	}
+
 	report.Log(os.Stdout)
-	err = report.EmailFail(config.Email.Address)
+	err := report.EmailRoutes(config)
+	if err != nil {
+		return report, err
+	}
+
+	if store != nil {
+		return report, alertBurnRate(config, store, report, checkedAt)
+	}
+
+	return report, nil
+}
+
+// track updates the state of every service in the report with the result of
+// its check, and sets it in the report.
+func track(store *sermonstate.Store, config *sermonconfig.Config, report *sermonreport.Report, t time.Time) error {
+	return store.UpdateStates(func(states map[string]*sermonstate.ServiceState) error {
+		for _, ss := range report.Services {
+			s := config.Services[ss.BaseName()]
+			state, ok := states[ss.Name]
+			if !ok {
+				state = &sermonstate.ServiceState{}
+				states[ss.Name] = state
+			}
+
+			state.Update(ss.Healthy, t, sermonstate.Policy{
+				FailThreshold:    s.FailThreshold,
+				RecoverThreshold: s.RecoverThreshold,
+				FlapWindow:       config.Flapping.Window.Duration,
+				FlapChanges:      config.Flapping.Changes,
+			})
+			ss.State = state.State()
+		}
+		return nil
+	})
+}
+
+// maintain flags the services in the report that are in a maintenance window,
+// or silenced, at time t.
+func maintain(config *sermonconfig.Config, silences []sermonstate.Silence, report *sermonreport.Report, t time.Time) {
+	for _, ss := range report.Services {
+		ss.MaintenanceReason, ss.Maintenance = suppressed(config, silences, ss.BaseName(), ss.Tags, t)
+	}
+}
+
+// suppressed checks if a service is in a maintenance window, or silenced, at
+// time t, and returns the reason.
+func suppressed(config *sermonconfig.Config, silences []sermonstate.Silence, name string, tags []string, t time.Time) (string, bool) {
+	if m := config.ActiveMaintenance(name, tags, t); m != nil {
+		return m.Reason, true
+	}
+	for _, silence := range silences {
+		if silence.Service == name && silence.Active(t) {
+			return silence.Reason, true
+		}
+	}
+	return "", false
+}
+
+// trackIncidents opens an incident for every service alerted on that doesn't
+// have one, records failures in the open ones and resolves them once the
+// services recover. The incidents are set in the report.
+func trackIncidents(store *sermonstate.Store, report *sermonreport.Report, t time.Time) error {
+	return store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+		for _, ss := range report.Services {
+			incident := sermonstate.OpenIncident(incidents, ss.Name)
+			if incident == nil && ss.Alerting() {
+				incident = sermonstate.NewIncident(ss.Name, t)
+				if ss.BaseName() != ss.Name {
+					incident.ConfigName = ss.BaseName()
+				}
+				incidents = append(incidents, incident)
+			}
+			if incident == nil {
+				continue
+			}
+
+			if !ss.Down() && ss.State != sermoncore.StateFlapping {
+				incident.Resolve(t)
+				continue
+			}
+
+			if ss.Err != nil {
+				incident.Fail(t, ss.Err.Error())
+			}
+			ss.Incident = incident.ID
+			if incident.Ack != nil {
+				ss.AckedBy = incident.Ack.By
+			}
+		}
+		return incidents, nil
+	})
+}
+
+// record appends the results of a report to the history.
+func record(store *sermonstate.Store, report *sermonreport.Report, t time.Time) error {
+	records := make([]sermonstate.Record, 0, len(report.Services))
+	for _, ss := range report.Services {
+		records = append(records, sermonstate.NewRecord(ss, t))
+	}
+	return store.Append(records...)
+}
+
+// retention is how long the history is kept: the longest period it's read
+// over, by the SLA, the burn rate alerts or the digest.
+func retention(config *sermonconfig.Config) time.Duration {
+	longest := config.SLA.Window.Duration
+	for _, d := range []time.Duration{config.SLA.BurnRateWindow.Duration, config.Digest.Period.Duration} {
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// SLA computes the availability of every service over the given window, up
+// to now, from the history in the state dir.
+func SLA(config *sermonconfig.Config, window time.Duration) (*sermonreport.SLAReport, error) {
+	store, err := openStore(config, "the SLA is computed from the check history")
+	if err != nil {
+		return nil, err
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-window)
+	records, err := store.History(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	slos := map[string]float64{}
+	for name, s := range config.Services {
+		s.Name = name
+		for _, family := range s.ByIPVersion() {
+			slos[family.Name] = s.SLO
+		}
+	}
+
+	return sermonreport.NewSLAReport(records, from, to, slos), nil
+}
+
+// alertBurnRate emails an alert if any service with an SLO is using up its
+// error budget too quickly over the burn rate window. Services under
+// maintenance in the report are left out. The same services are only alerted
+// on again after the cooldown, the alert is sent right away if they change.
+func alertBurnRate(config *sermonconfig.Config, store *sermonstate.Store, report *sermonreport.Report, t time.Time) error {
+	hasSLO := false
+	for _, s := range config.Services {
+		hasSLO = hasSLO || s.SLO > 0
+	}
+	if !hasSLO {
+		return nil
+	}
+
+	sla, err := SLA(config, config.SLA.BurnRateWindow.Duration)
+	if err != nil {
+		return err
+	}
+
+	maintenance := map[string]bool{}
+	for _, ss := range report.Services {
+		maintenance[ss.Name] = ss.Maintenance
+	}
+
+	burning := sla.Burning(config.SLA.BurnRateThreshold)
+	kept := burning.Services[:0]
+	for _, s := range burning.Services {
+		if !maintenance[s.Service] {
+			kept = append(kept, s)
+		}
+	}
+	burning.Services = kept
+
+	names := make([]string, 0, len(burning.Services))
+	for _, s := range burning.Services {
+		names = append(names, s.Service)
+	}
+	if len(names) > 0 {
+		burning.Log(os.Stdout)
+	}
+	return store.AlertBurning(names, t, config.SLA.BurnRateCooldown.Duration, func() error {
+		return burning.Alert(config)
+	})
+}
+
+// Digest summarizes the history of the given period, up to now, and sends it
+// via email and, if configured, to the digest webhook.
+func Digest(config *sermonconfig.Config, period time.Duration) error {
+	store, err := openStore(config, "the digest is built from the check history")
+	if err != nil {
+		return err
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-period)
+	records, err := store.History(from, to)
+	if err != nil {
+		return err
+	}
+
+	digest := sermonreport.NewDigest(records, from, to, config.Digest)
+	err = digest.Log(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	err = digest.Email(config)
 	if err != nil {
 		return err
 	}
 
+	if config.Digest.Webhook != nil {
+		return digest.Post(config)
+	}
+
 	return nil
 }
 
@@ -83,3 +508,235 @@ func withRetry[T any, U any](
 		return result
 	}
 }
+
+// Silence silences the given services for a while, from now on.
+func Silence(config *sermonconfig.Config, services []string, d time.Duration, reason string) ([]sermonstate.Silence, error) {
+	if len(services) == 0 {
+		return nil, errors.New("Missing service to silence")
+	}
+	if d <= 0 {
+		return nil, fmt.Errorf("Invalid silence duration %s", d)
+	}
+	for _, name := range services {
+		if _, ok := config.Services[name]; !ok {
+			return nil, fmt.Errorf("Unknown service %s", name)
+		}
+	}
+
+	store, err := openStore(config, "silences are kept in the state store")
+	if err != nil {
+		return nil, err
+	}
+
+	silences := make([]sermonstate.Silence, 0, len(services))
+	for _, name := range services {
+		silence := sermonstate.NewSilence(name, d, reason)
+		if err = store.AddSilence(silence); err != nil {
+			return nil, err
+		}
+		silences = append(silences, silence)
+	}
+	return silences, nil
+}
+
+// Silences returns the silences that haven't ended yet.
+func Silences(config *sermonconfig.Config) ([]sermonstate.Silence, error) {
+	store, err := openStore(config, "silences are kept in the state store")
+	if err != nil {
+		return nil, err
+	}
+	return store.Silences(time.Now())
+}
+
+// Unsilence removes a silence by ID.
+func Unsilence(config *sermonconfig.Config, id string) error {
+	store, err := openStore(config, "silences are kept in the state store")
+	if err != nil {
+		return err
+	}
+
+	found, err := store.RemoveSilence(id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("Unknown silence %s", id)
+	}
+	return nil
+}
+
+// openStore opens the state store in the `state_dir`, the reason is what it's
+// needed for, in case it's not configured.
+func openStore(config *sermonconfig.Config, reason string) (*sermonstate.Store, error) {
+	if config.StateDir == "" {
+		return nil, fmt.Errorf("Missing `state_dir`, %s", reason)
+	}
+	return sermonstate.Open(config.StateDir)
+}
+
+// Incidents returns the open incidents or, if all is set, every incident.
+func Incidents(config *sermonconfig.Config, all bool) ([]*sermonstate.Incident, error) {
+	store, err := openStore(config, "incidents are kept in the state store")
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := store.Incidents()
+	if err != nil || all {
+		return incidents, err
+	}
+
+	open := incidents[:0]
+	for _, i := range incidents {
+		if i.IsOpen() {
+			open = append(open, i)
+		}
+	}
+	return open, nil
+}
+
+// Acknowledge acknowledges an incident, given its ID, or the open incidents
+// of a service, given its name. For services checked over both IP versions,
+// the name in the config acknowledges the incidents of both.
+func Acknowledge(config *sermonconfig.Config, idOrService string, by string, note string) ([]*sermonstate.Incident, error) {
+	store, err := openStore(config, "incidents are kept in the state store")
+	if err != nil {
+		return nil, err
+	}
+
+	incidents, err := store.Incidents()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{idOrService}
+	if open := sermonstate.OpenIncidents(incidents, idOrService); len(open) > 0 {
+		ids = ids[:0]
+		for _, incident := range open {
+			ids = append(ids, incident.ID)
+		}
+	}
+
+	acked := make([]*sermonstate.Incident, 0, len(ids))
+	for _, id := range ids {
+		incident, err := store.Acknowledge(id, by, note)
+		if err != nil {
+			return acked, err
+		}
+		acked = append(acked, incident)
+	}
+	return acked, nil
+}
+
+// Escalate notifies the levels of their escalation policy that are due about
+// the open incidents that haven't been acknowledged, unless their service is
+// under maintenance or silenced. Levels are notified without holding the lock
+// of the incidents, so acknowledgements aren't held up meanwhile, and only
+// the incidents that are still unacknowledged afterwards are marked as
+// escalated.
+func Escalate(config *sermonconfig.Config, now time.Time) error {
+	if len(config.Escalations) == 0 {
+		return nil
+	}
+
+	store, err := openStore(config, "escalations are evaluated against the incidents in the state store")
+	if err != nil {
+		return err
+	}
+	incidents, err := store.Incidents()
+	if err != nil {
+		return err
+	}
+	silences, err := store.Silences(now)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	escalated := map[string]int{}
+	for _, incident := range incidents {
+		if !incident.IsOpen() || incident.Ack != nil {
+			continue
+		}
+
+		service := incident.BaseName()
+		tags := config.Services[service].Tags
+		if _, ok := suppressed(config, silences, service, tags, now); ok {
+			continue
+		}
+		name, policy := config.EscalationFor(service, tags)
+		if policy == nil {
+			continue
+		}
+
+		level := incident.Escalated
+		for level < len(policy.Levels) && now.Sub(incident.Opened) >= policy.Levels[level].After.Duration {
+			if err := sermonreport.Escalate(config, config.Services[service], incident, name, level); err != nil {
+				errs = append(errs, err.Error())
+				break
+			}
+			level++
+		}
+		if level > incident.Escalated {
+			escalated[incident.ID] = level
+		}
+	}
+
+	if len(escalated) > 0 {
+		err = store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+			for _, incident := range incidents {
+				level, ok := escalated[incident.ID]
+				if ok && incident.IsOpen() && incident.Ack == nil && level > incident.Escalated {
+					incident.Escalated = level
+				}
+			}
+			return incidents, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Serve serves the admin API and, as a daemon, evaluates escalations every
+// escalationInterval. If interval is set, it also checks all services every
+// interval, as RunConfig does, and serves the metrics of the last run. Failing runs
+// are logged and don't stop the daemon.
+func Serve(config *sermonconfig.Config, interval time.Duration) error {
+	store, err := openStore(config, "the admin API manages the state store")
+	if err != nil {
+		return err
+	}
+
+	server := sermonserver.New(config, store)
+	if interval > 0 {
+		go every(interval, func() error {
+			report, err := run(config)
+			server.Observe(report)
+			return err
+		})
+	}
+	go every(escalationInterval, func() error {
+		return Escalate(config, time.Now())
+	})
+
+	return server.ListenAndServe()
+}
+
+// every calls fn right away and then every interval, logging its errors.
+func every(interval time.Duration, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := fn(); err != nil {
+			log.Println(err)
+		}
+		<-ticker.C
+	}
+}
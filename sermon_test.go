@@ -1,9 +1,22 @@
 package sermon
 
 import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermoncore"
+	"gitlab.com/germandv/sermon/sermonreport"
+	"gitlab.com/germandv/sermon/sermonstate"
 )
 
 func TestWithRetry(t *testing.T) {
@@ -47,3 +60,319 @@ func TestWithRetry(t *testing.T) {
 		expect.Equal(t, invocations, wantAttempts)
 	})
 }
+
+func TestTrackIncidents(t *testing.T) {
+	store, err := sermonstate.Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func(minutes int, ss *sermoncore.ServiceStatus) *sermoncore.ServiceStatus {
+		report := &sermonreport.Report{}
+		report.Add(ss)
+		expect.NoError(t, trackIncidents(store, report, start.Add(time.Duration(minutes)*time.Minute)))
+		return ss
+	}
+
+	ss := run(0, &sermoncore.ServiceStatus{Name: "a.test", Healthy: false, Err: errors.New("timeout"), State: sermoncore.StateUp})
+	expect.Equal(t, ss.Incident, "")
+
+	ss = run(5, &sermoncore.ServiceStatus{Name: "a.test", Healthy: false, Err: errors.New("timeout"), State: sermoncore.StateDown})
+	expect.Equal(t, ss.Incident != "", true)
+	id := ss.Incident
+
+	_, err = store.Acknowledge(id, "jane", "On it")
+	expect.NoError(t, err)
+
+	ss = run(10, &sermoncore.ServiceStatus{Name: "a.test", Healthy: false, Err: errors.New("500"), State: sermoncore.StateDown})
+	expect.Equal(t, ss.Incident, id)
+	expect.Equal(t, ss.AckedBy, "jane")
+	expect.Equal(t, ss.Alerting(), false)
+
+	ss = run(15, &sermoncore.ServiceStatus{Name: "a.test", Healthy: true, State: sermoncore.StateUp})
+	expect.Equal(t, ss.Incident, "")
+
+	incidents, err := store.Incidents()
+	expect.NoError(t, err)
+	expect.Equal(t, len(incidents), 1)
+	expect.Equal(t, incidents[0].Attempts, 2)
+	expect.Equal(t, incidents[0].Errors[1].Error, "500")
+	expect.Equal(t, *incidents[0].Resolved, start.Add(15*time.Minute))
+}
+
+func TestEscalate(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[r.URL.Path]++
+	}))
+	defer server.Close()
+
+	webhook := func(path string) *sermoncore.Endpoint {
+		u, err := url.Parse(server.URL + path)
+		expect.NoError(t, err)
+		return &sermoncore.Endpoint{URL: u}
+	}
+
+	config := &sermonconfig.Config{
+		StateDir: filepath.Join(t.TempDir(), "state"),
+		Services: map[string]sermoncore.Service{
+			"api": {Tags: []string{"backend"}},
+			"web": {},
+		},
+		Escalations: map[string]sermonconfig.Escalation{
+			"backend": {
+				Tags: []string{"backend"},
+				Levels: []sermonconfig.EscalationLevel{
+					{Webhook: webhook("/level1")},
+					{After: sermonconfig.Duration{Duration: 15 * time.Minute}, Webhook: webhook("/level2")},
+					{After: sermonconfig.Duration{Duration: time.Hour}, Webhook: webhook("/level3")},
+				},
+			},
+		},
+	}
+
+	store, err := sermonstate.Open(config.StateDir)
+	expect.NoError(t, err)
+	opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := sermonstate.NewIncident("api", opened)
+	web := sermonstate.NewIncident("web", opened)
+	err = store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+		return append(incidents, api, web), nil
+	})
+	expect.NoError(t, err)
+
+	expect.NoError(t, Escalate(config, opened.Add(time.Minute)))
+	expect.NoError(t, Escalate(config, opened.Add(2*time.Minute)))
+	expect.Equal(t, calls["/level1"], 1)
+	expect.Equal(t, calls["/level2"], 0)
+
+	expect.NoError(t, Escalate(config, opened.Add(16*time.Minute)))
+	expect.Equal(t, calls["/level2"], 1)
+
+	_, err = store.Acknowledge(api.ID, "jane", "")
+	expect.NoError(t, err)
+	expect.NoError(t, Escalate(config, opened.Add(2*time.Hour)))
+	expect.Equal(t, calls["/level3"], 0)
+
+	incidents, err := store.Incidents()
+	expect.NoError(t, err)
+	expect.Equal(t, incidents[0].Escalated, 2)
+	expect.Equal(t, incidents[1].Escalated, 0)
+}
+
+func TestCheckHeartbeat(t *testing.T) {
+	store, err := sermonstate.Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := sermoncore.Service{
+		Name:   "backups",
+		Type:   sermoncore.TypeHeartbeat,
+		Period: sermoncore.Period{Duration: time.Hour},
+		Grace:  sermoncore.Period{Duration: 10 * time.Minute},
+		Tags:   []string{"jobs"},
+	}
+
+	ss := CheckHeartbeat(s, store, start)
+	expect.Equal(t, ss.Healthy, true)
+	expect.Equal(t, ss.Tags[0], "jobs")
+
+	ss = CheckHeartbeat(s, store, start.Add(71*time.Minute))
+	expect.Equal(t, ss.Healthy, false)
+	expect.Contains(t, ss.Err.Error(), "No ping received in 1h10m0s")
+
+	err = store.UpdateHeartbeat("backups", start, func(h *sermonstate.Heartbeat) {
+		h.Start(start.Add(70 * time.Minute))
+		h.Ping(start.Add(72 * time.Minute))
+	})
+	expect.NoError(t, err)
+
+	ss = CheckHeartbeat(s, store, start.Add(73*time.Minute))
+	expect.Equal(t, ss.Healthy, true)
+	expect.Equal(t, ss.Duration, 2*time.Minute)
+}
+
+func TestCheckReusesConnections(t *testing.T) {
+	var mu sync.Mutex
+	opened := 0
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			opened++
+			mu.Unlock()
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	newService := func(reuse bool) sermoncore.Service {
+		return sermoncore.Service{
+			Name:             "api.test",
+			Endpoint:         sermoncore.Endpoint{URL: u},
+			Codes:            []sermoncore.StatusCode{{Code: 200}},
+			Timeout:          sermoncore.Timeout{Duration: time.Second},
+			ReuseConnections: &reuse,
+		}
+	}
+	countOpened := func(s sermoncore.Service) int {
+		mu.Lock()
+		opened = 0
+		mu.Unlock()
+		for i := 0; i < 3; i++ {
+			ss := Check(s)
+			expect.NoError(t, ss.Err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return opened
+	}
+
+	expect.Equal(t, countOpened(newService(true)), 1)
+	expect.Equal(t, countOpened(newService(false)), 3)
+
+	t.Run("ReloadsRotatedCertificates", func(t *testing.T) {
+		ca, err := os.ReadFile("testdata/tls/ca.pem")
+		expect.NoError(t, err)
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		expect.NoError(t, os.WriteFile(caFile, ca, 0o600))
+
+		s := newService(true)
+		s.TLS = sermoncore.TLS{CAFile: caFile}
+		expect.Equal(t, countOpened(s), 1)
+		expect.Equal(t, countOpened(s), 0)
+
+		rotated := time.Now().Add(time.Minute)
+		expect.NoError(t, os.Chtimes(caFile, rotated, rotated))
+		expect.Equal(t, countOpened(s), 1)
+	})
+}
+
+func TestCheckOverIPVersion(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	expect.NoError(t, err)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.Listener = ln
+	ts.Start()
+	defer ts.Close()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	u, _ := url.Parse("http://localhost:" + port)
+	service := sermoncore.Service{
+		Name:      "api.test",
+		Endpoint:  sermoncore.Endpoint{URL: u},
+		Codes:     []sermoncore.StatusCode{{Code: 200}},
+		Timeout:   sermoncore.Timeout{Duration: time.Second},
+		IPVersion: sermoncore.IPVersion{Version: sermoncore.IPBoth},
+	}
+
+	services := service.ByIPVersion()
+	ipv4 := Check(services[0])
+	expect.Equal(t, ipv4.Name, "api.test (IPv4)")
+	expect.NoError(t, ipv4.Err)
+
+	ipv6 := Check(services[1])
+	expect.Equal(t, ipv6.Name, "api.test (IPv6)")
+	expect.Equal(t, ipv6.ConfigName, "api.test")
+	expect.Equal(t, ipv6.IPVersion, sermoncore.IPv6)
+	expect.Equal(t, ipv6.Healthy, false)
+}
+
+func TestAcknowledgeEveryIPVersion(t *testing.T) {
+	config := &sermonconfig.Config{StateDir: filepath.Join(t.TempDir(), "state")}
+	store, err := sermonstate.Open(config.StateDir)
+	expect.NoError(t, err)
+
+	report := &sermonreport.Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "api (IPv4)", ConfigName: "api", State: sermoncore.StateDown})
+	report.Add(&sermoncore.ServiceStatus{Name: "api (IPv6)", ConfigName: "api", State: sermoncore.StateDown})
+	report.Add(&sermoncore.ServiceStatus{Name: "web", ConfigName: "web", State: sermoncore.StateDown})
+	expect.NoError(t, trackIncidents(store, report, time.Now()))
+
+	acked, err := Acknowledge(config, "api", "jane", "On it")
+	expect.NoError(t, err)
+	expect.Equal(t, len(acked), 2)
+
+	incidents, err := store.Incidents()
+	expect.NoError(t, err)
+	for _, incident := range incidents {
+		expect.Equal(t, incident.Ack != nil, incident.BaseName() == "api")
+	}
+}
+
+func TestEscalateKeepsAcksMadeWhileNotifying(t *testing.T) {
+	config := &sermonconfig.Config{
+		StateDir: filepath.Join(t.TempDir(), "state"),
+		Services: map[string]sermoncore.Service{"api": {}, "web": {}},
+	}
+	store, err := sermonstate.Open(config.StateDir)
+	expect.NoError(t, err)
+
+	opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	api := sermonstate.NewIncident("api", opened)
+	web := sermonstate.NewIncident("web", opened)
+	err = store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+		return append(incidents, api, web), nil
+	})
+	expect.NoError(t, err)
+
+	// The webhook acknowledges the incident, as someone using the admin API
+	// would while the escalation is being sent.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := store.Acknowledge(api.ID, "jane", "On it")
+		expect.NoError(t, err)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	config.Escalations = map[string]sermonconfig.Escalation{
+		"api": {
+			Services: []string{"api"},
+			Levels:   []sermonconfig.EscalationLevel{{Webhook: &sermoncore.Endpoint{URL: u}}},
+		},
+	}
+
+	expect.NoError(t, Escalate(config, opened.Add(time.Minute)))
+
+	incidents, err := store.Incidents()
+	expect.NoError(t, err)
+	expect.Equal(t, incidents[0].Ack.By, "jane")
+	expect.Equal(t, incidents[0].Escalated, 0)
+}
+
+func TestEscalateSkipsSilencedServices(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+
+	config := &sermonconfig.Config{
+		StateDir: filepath.Join(t.TempDir(), "state"),
+		Services: map[string]sermoncore.Service{"api": {}},
+		Escalations: map[string]sermonconfig.Escalation{
+			"api": {
+				Services: []string{"api"},
+				Levels:   []sermonconfig.EscalationLevel{{Webhook: &sermoncore.Endpoint{URL: u}}},
+			},
+		},
+	}
+	store, err := sermonstate.Open(config.StateDir)
+	expect.NoError(t, err)
+
+	now := time.Now()
+	err = store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+		return append(incidents, sermonstate.NewIncident("api", now.Add(-time.Hour))), nil
+	})
+	expect.NoError(t, err)
+	expect.NoError(t, store.AddSilence(sermonstate.NewSilence("api", time.Hour, "Migrating")))
+
+	expect.NoError(t, Escalate(config, time.Now()))
+	expect.Equal(t, calls, 0)
+}
@@ -3,9 +3,10 @@ package sermonconfig
 import (
 	"errors"
 	"fmt"
+	"net/url"
+	"path/filepath"
 	"regexp"
 	"strconv"
-	"time"
 
 	"github.com/BurntSushi/toml"
 	"gitlab.com/germandv/sermon/sermoncore"
@@ -38,41 +39,214 @@ func (a *Attempts) UnmarshalText(text []byte) error {
 	return nil
 }
 
-// Config represents the structure of the TOML file that lists the services
+// Config represents the structure of the config file that lists the services
 // to be checked and some common settings.
 type Config struct {
-	Email    Email
-	Attempts Attempts
+	Email         Email
+	Recipients    Recipients
+	Routes        []Route
+	Notifications Notifications
+	Attempts      Attempts
+	SMTP          *SMTP
+	// StateDir is where the history of checks is kept, it's not kept if
+	// empty.
+	StateDir string `toml:"state_dir"`
+	Digest   Digest
+	SLA      SLA
+	Flapping Flapping
+	// Maintenance are the periods in which notifications about services
+	// are suppressed.
+	Maintenance []Maintenance
+	Escalations map[string]Escalation
+	Server      Server
+	// Proxy is the proxy services are checked through, unless they set
+	// their own.
+	Proxy    sermoncore.Proxy
 	Services map[string]sermoncore.Service
 }
 
+// ParseFile reads and parses a config file, along with the files listed in its
+// `include` globs and the files found in serviceDirs. Included files can only
+// define services, which are merged into the main config. Relative paths to
+// files are relative to the file they're set in. If format is empty, it's
+// detected from the file extension.
+func ParseFile(path string, format Format, serviceDirs ...string) (*Config, error) {
+	data, err := loadFile(path, format)
+	if err != nil {
+		return nil, err
+	}
+
+	origins := serviceOrigins(data, path)
+	// Paths in included files are resolved from their own directory.
+	resolvePaths(data, filepath.Dir(path))
+
+	err = resolveIncludes(data, filepath.Dir(path), origins)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range serviceDirs {
+		err = includeDir(data, dir, origins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config, err := parseDocument(data)
+	var de *decodeError
+	if errors.As(err, &de) {
+		return nil, fmt.Errorf("%s: %w", keyOrigin(de.key, path, origins), err)
+	}
+	return config, err
+}
+
+// ParseAs parses a config written in the given format, along with the files
+// found in serviceDirs.
+func ParseAs(config string, format Format, serviceDirs ...string) (*Config, error) {
+	data, err := decode(config, format)
+	if err != nil {
+		return nil, err
+	}
+
+	origins := serviceOrigins(data, "config")
+	for _, dir := range serviceDirs {
+		err = includeDir(data, dir, origins)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parseDocument(data)
+}
+
 // Parse parses the TOML file that lists the services to monitor.
 func Parse(config string) (*Config, error) {
+	return ParseAs(config, TOML)
+}
+
+// parseDocument parses a config that has already been decoded into a generic
+// document. Defaults and templates are applied and the result is transcoded to
+// TOML, so every format goes through the same decoding and validation.
+func parseDocument(data map[string]interface{}) (*Config, error) {
+	err := applyDefaults(data)
+	if err != nil {
+		return nil, err
+	}
+	localTimes(data)
+
+	config, err := transcode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeConfig(config)
+}
+
+// decodeConfig decodes a TOML config into a Config and validates it.
+func decodeConfig(config string) (*Config, error) {
 	cfg := &Config{}
 
 	_, err := toml.Decode(config, cfg)
 	if err != nil {
-		return nil, err
+		return nil, decodeErr(err)
 	}
 
-	if cfg.Email.Address == "" {
-		return nil, errors.New("Missing `email`")
+	if err := cfg.validateRecipients(); err != nil {
+		return nil, err
 	}
 	if cfg.Attempts.Value == 0 {
 		return nil, errors.New("Missing `attempts`")
 	}
+	cfg.Digest.setDefaults()
+	if err := cfg.Digest.validate(); err != nil {
+		return nil, err
+	}
+	cfg.SLA.setDefaults()
+	if err := cfg.SLA.validate(); err != nil {
+		return nil, err
+	}
+	cfg.Server.setDefaults()
+	if err := cfg.Server.validate(); err != nil {
+		return nil, err
+	}
+	cfg.Flapping.setDefaults()
+	if err := cfg.Flapping.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Flapping.Changes > 0 && cfg.StateDir == "" {
+		return nil, errors.New("Missing `state_dir`, needed to detect flapping services")
+	}
+	if err := cfg.Notifications.Email.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.SMTP != nil {
+		if err := cfg.SMTP.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make(map[string]bool, len(cfg.Services))
+	for name := range cfg.Services {
+		names[name] = true
+	}
+	for i := range cfg.Maintenance {
+		if err := cfg.Maintenance[i].validate(names); err != nil {
+			return nil, err
+		}
+	}
+	for name, e := range cfg.Escalations {
+		if err := e.validate(name, names); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateDependencies(cfg.Services); err != nil {
+		return nil, err
+	}
+
+	if err := validateTokens(cfg.Services); err != nil {
+		return nil, err
+	}
 
 	for name, s := range cfg.Services {
-		if s.Endpoint.URL == nil {
-			return nil, fmt.Errorf("Missing `endpoint` for service %s", name)
+		if s.Proxy.IsZero() && !cfg.Proxy.IsZero() {
+			s.Proxy = cfg.Proxy
+			cfg.Services[name] = s
+		}
+		if err := validateCheck(name, s, cfg.StateDir); err != nil {
+			return nil, err
+		}
+		if err := validateURL(s.RunbookURL); err != nil {
+			return nil, fmt.Errorf("Invalid `runbook_url` for service %s: %w", name, err)
+		}
+		if err := validateURL(s.DashboardURL); err != nil {
+			return nil, fmt.Errorf("Invalid `dashboard_url` for service %s: %w", name, err)
 		}
-		if len(s.Codes) == 0 {
-			return nil, fmt.Errorf("Missing `codes` for service %s", name)
+		if s.SLO < 0 || s.SLO >= 100 {
+			return nil, fmt.Errorf("Invalid `slo` for service %s: %v, it must be a percentage below 100", name, s.SLO)
 		}
-		if s.Timeout.Duration == time.Duration(0) {
-			return nil, fmt.Errorf("Missing `timeout` for service %s", name)
+		if s.FailThreshold < 0 || s.RecoverThreshold < 0 {
+			return nil, fmt.Errorf("Invalid `fail_threshold` or `recover_threshold` for service %s", name)
+		}
+		if (s.FailThreshold > 1 || s.RecoverThreshold > 1) && cfg.StateDir == "" {
+			return nil, fmt.Errorf("Missing `state_dir`, needed by the thresholds of service %s", name)
 		}
 	}
 
 	return cfg, nil
 }
+
+// validateURL checks an optional URL is an absolute http(s) one, so it can
+// be followed from a notification.
+func validateURL(u string) error {
+	if u == "" {
+		return nil
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%s is not an absolute http(s) URL", u)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package sermonconfig
+
+import (
+	"fmt"
+)
+
+const (
+	defaultsKey  = "defaults"
+	templatesKey = "templates"
+	extendsKey   = "extends"
+)
+
+// applyDefaults merges the `[defaults]` section and the `[templates.*]` a
+// service `extends` into every service. Precedence, from lowest to highest, is
+// defaults, template and service; tables (ie: `headers`) are merged deeply,
+// any other value is replaced.
+func applyDefaults(data map[string]interface{}) error {
+	defaults := map[string]interface{}{}
+	if raw, ok := data[defaultsKey]; ok {
+		defaults, ok = raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid `%s`, want a table", defaultsKey)
+		}
+	}
+
+	templates := map[string]interface{}{}
+	if raw, ok := data[templatesKey]; ok {
+		templates, ok = raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid `%s`, want a table", templatesKey)
+		}
+	}
+
+	delete(data, defaultsKey)
+	delete(data, templatesKey)
+
+	services, _ := data[servicesKey].(map[string]interface{})
+	for name, raw := range services {
+		service, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Invalid service %s, want a table", name)
+		}
+
+		resolved, err := extend(service, templates, []string{})
+		if err != nil {
+			return fmt.Errorf("%w for service %s", err, name)
+		}
+
+		services[name] = deepMerge(defaults, resolved)
+	}
+
+	return nil
+}
+
+// extend merges a table on top of the template it extends, if any, following
+// the chain of templates extending other templates.
+func extend(table map[string]interface{}, templates map[string]interface{}, chain []string) (map[string]interface{}, error) {
+	raw, ok := table[extendsKey]
+	if !ok {
+		return table, nil
+	}
+
+	name, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("Invalid `%s`, want a template name", extendsKey)
+	}
+	for _, n := range chain {
+		if n == name {
+			return nil, fmt.Errorf("Circular `%s` of template %s", extendsKey, name)
+		}
+	}
+
+	template, ok := templates[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unknown template %s", name)
+	}
+
+	base, err := extend(template, templates, append(chain, name))
+	if err != nil {
+		return nil, err
+	}
+
+	merged := deepMerge(base, table)
+	delete(merged, extendsKey)
+	return merged, nil
+}
+
+// deepMerge returns a new table with the values of src on top of the ones in
+// dst. Nested tables are merged recursively, neither dst nor src is modified.
+func deepMerge(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+
+	for k, v := range src {
+		srcTable, srcOk := v.(map[string]interface{})
+		dstTable, dstOk := merged[k].(map[string]interface{})
+		if srcOk && dstOk {
+			merged[k] = deepMerge(dstTable, srcTable)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,59 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// validateDependencies checks every service depends on known services, and
+// there are no circular dependencies.
+func validateDependencies(services map[string]sermoncore.Service) error {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, dep := range services[name].DependsOn {
+			if _, ok := services[dep]; !ok {
+				return fmt.Errorf("Unknown service %s in `depends_on` of service %s", dep, name)
+			}
+		}
+	}
+
+	done := map[string]bool{}
+	for _, name := range names {
+		if err := walkDependencies(services, name, []string{}, done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkDependencies follows the dependencies of a service, chain being the
+// services that led to it.
+func walkDependencies(services map[string]sermoncore.Service, name string, chain []string, done map[string]bool) error {
+	for i, n := range chain {
+		if n == name {
+			cycle := append(chain[i:], name)
+			return fmt.Errorf("Circular `depends_on`: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if done[name] {
+		return nil
+	}
+
+	chain = append(chain, name)
+	for _, dep := range services[name].DependsOn {
+		if err := walkDependencies(services, dep, chain, done); err != nil {
+			return err
+		}
+	}
+
+	done[name] = true
+	return nil
+}
@@ -0,0 +1,67 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/duration"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+const (
+	DefaultDigestPeriod     = 7 * 24 * time.Hour
+	DefaultDigestSlowest    = 5
+	DefaultDigestCertExpiry = 30 * 24 * time.Hour
+)
+
+// Duration is a time.Duration which, on top of the usual units, accepts a
+// number of days, ie: `7d`.
+type Duration struct {
+	Duration time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = duration.Parse(string(text))
+	return err
+}
+
+// Digest holds the settings of the digest report, a summary of the history of
+// every service over a period.
+type Digest struct {
+	// Period is how far back the digest goes, 7 days by default.
+	Period Duration
+	// Recipients of the digest email, if empty it's sent to the default ones.
+	Recipients
+	// Webhook is a URL the digest is posted to as JSON.
+	Webhook *sermoncore.Endpoint
+	// Slowest is the number of slowest services to list, 5 by default.
+	Slowest int
+	// CertExpiry lists services with certificates expiring within this
+	// duration, 30 days by default.
+	CertExpiry Duration `toml:"cert_expiry"`
+}
+
+// setDefaults sets the default value of the settings that are not set.
+func (d *Digest) setDefaults() {
+	if d.Period.Duration == 0 {
+		d.Period.Duration = DefaultDigestPeriod
+	}
+	if d.Slowest == 0 {
+		d.Slowest = DefaultDigestSlowest
+	}
+	if d.CertExpiry.Duration == 0 {
+		d.CertExpiry.Duration = DefaultDigestCertExpiry
+	}
+}
+
+// validate checks the digest settings are valid.
+func (d *Digest) validate() error {
+	if d.Period.Duration < 0 {
+		return fmt.Errorf("Invalid `period` in `digest`: %s", d.Period.Duration)
+	}
+	if d.Slowest < 0 {
+		return fmt.Errorf("Invalid `slowest` in `digest`: %d", d.Slowest)
+	}
+	return nil
+}
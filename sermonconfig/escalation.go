@@ -0,0 +1,83 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"sort"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// Escalation is a policy to notify more and more people about an incident, the
+// longer it goes unacknowledged. It applies to the services listed and the
+// ones with any of the tags.
+type Escalation struct {
+	Services []string
+	Tags     []string
+	Levels   []EscalationLevel
+}
+
+// EscalationLevel is a step of an escalation policy, it notifies its webhook
+// and recipients once an incident has been open for a while.
+type EscalationLevel struct {
+	// After is how long after the incident opened the level is notified.
+	After   Duration
+	Webhook *sermoncore.Endpoint
+	Recipients
+}
+
+// Covers checks if the policy applies to a service.
+func (e *Escalation) Covers(name string, tags []string) bool {
+	if contains(e.Services, name) {
+		return true
+	}
+	for _, tag := range tags {
+		if contains(e.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the policy applies to known services and its levels notify
+// someone, in order.
+func (e *Escalation) validate(name string, services map[string]bool) error {
+	if len(e.Services) == 0 && len(e.Tags) == 0 {
+		return fmt.Errorf("Missing `services` or `tags` in escalation %s", name)
+	}
+	for _, s := range e.Services {
+		if !services[s] {
+			return fmt.Errorf("Unknown service %s in escalation %s", s, name)
+		}
+	}
+
+	if len(e.Levels) == 0 {
+		return fmt.Errorf("Missing `levels` in escalation %s", name)
+	}
+	for i, level := range e.Levels {
+		if level.Webhook == nil && level.Empty() {
+			return fmt.Errorf("Missing `webhook`, or `to`, `cc` or `bcc`, in level %d of escalation %s", i+1, name)
+		}
+		if level.After.Duration < 0 || (i > 0 && level.After.Duration < e.Levels[i-1].After.Duration) {
+			return fmt.Errorf("Invalid `after` in level %d of escalation %s, levels must be in order", i+1, name)
+		}
+	}
+	return nil
+}
+
+// EscalationFor returns the name and escalation policy of a service, or nil if
+// it has none. If several policies apply, the first one by name is used.
+func (c *Config) EscalationFor(name string, tags []string) (string, *Escalation) {
+	names := make([]string, 0, len(c.Escalations))
+	for n := range c.Escalations {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	for _, n := range names {
+		e := c.Escalations[n]
+		if e.Covers(name, tags) {
+			return n, &e
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,61 @@
+package sermonconfig
+
+import (
+	"fmt"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// Filter selects a subset of the services in a config.
+type Filter struct {
+	// Tags keeps only services with at least one of these tags.
+	Tags []string
+	// ExcludeTags drops services with any of these tags.
+	ExcludeTags []string
+	// Only keeps only the services with these names.
+	Only []string
+}
+
+// Match checks if a service is selected by the filter.
+func (f *Filter) Match(name string, s sermoncore.Service) bool {
+	if len(f.Only) > 0 && !contains(f.Only, name) {
+		return false
+	}
+	if len(f.Tags) > 0 && !s.HasTag(f.Tags...) {
+		return false
+	}
+	if s.HasTag(f.ExcludeTags...) {
+		return false
+	}
+	return true
+}
+
+// Filter returns a copy of the config with only the services selected by the
+// given filter. It fails if a service listed in `Only` does not exist.
+func (c *Config) Filter(f Filter) (*Config, error) {
+	for _, name := range f.Only {
+		if _, ok := c.Services[name]; !ok {
+			return nil, fmt.Errorf("Unknown service %s", name)
+		}
+	}
+
+	filtered := *c
+	filtered.Services = make(map[string]sermoncore.Service)
+	for name, s := range c.Services {
+		if f.Match(name, s) {
+			filtered.Services[name] = s
+		}
+	}
+
+	return &filtered, nil
+}
+
+// contains checks if the given item is included in the given slice of items.
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultFlapWindow = time.Hour
+
+// Flapping holds the settings to detect services whose checks keep changing
+// from passing to failing, and the other way around. Alerts about them are
+// suppressed while they're FLAPPING.
+type Flapping struct {
+	// Changes is how many times the result of the checks has to change
+	// within the window for a service to be flapping. There's no flap
+	// detection if it's zero.
+	Changes int
+	// Window is the period changes are counted over, 1 hour by default.
+	Window Duration
+}
+
+// setDefaults sets the default value of the settings that are not set.
+func (f *Flapping) setDefaults() {
+	if f.Window.Duration == 0 {
+		f.Window.Duration = DefaultFlapWindow
+	}
+}
+
+// validate checks the flapping settings are valid.
+func (f *Flapping) validate() error {
+	if f.Changes < 0 {
+		return fmt.Errorf("Invalid `changes` in `flapping`: %d", f.Changes)
+	}
+	if f.Window.Duration < 0 {
+		return fmt.Errorf("Invalid `window` in `flapping`: %s", f.Window.Duration)
+	}
+	return nil
+}
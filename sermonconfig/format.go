@@ -0,0 +1,225 @@
+package sermonconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format a config file is written in.
+type Format string
+
+const (
+	TOML Format = "toml"
+	YAML Format = "yaml"
+	JSON Format = "json"
+)
+
+// ParseFormat validates a format name, as given in a CLI flag.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case TOML, YAML, JSON:
+		return f, nil
+	case "yml":
+		return YAML, nil
+	default:
+		return "", fmt.Errorf("Unsupported config format: %s", name)
+	}
+}
+
+// FormatFromPath detects the format of a config file from its extension.
+func FormatFromPath(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return "", fmt.Errorf("Unable to detect config format of %s, missing file extension", path)
+	}
+	return ParseFormat(ext)
+}
+
+// decode decodes a config written in the given format into a generic document.
+func decode(config string, format Format) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+
+	switch format {
+	case TOML:
+		if _, err := toml.Decode(config, &data); err != nil {
+			return nil, err
+		}
+	case YAML:
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(config), &doc); err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			break
+		}
+		v, err := yamlValue(&doc)
+		if err != nil {
+			return nil, err
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("Invalid config, want a mapping of settings")
+		}
+		data = m
+	case JSON:
+		dec := json.NewDecoder(strings.NewReader(config))
+		dec.UseNumber()
+		if err := dec.Decode(&data); err != nil {
+			return nil, err
+		}
+		data = jsonNumbers(data).(map[string]interface{})
+	default:
+		return nil, fmt.Errorf("Unsupported config format: %s", format)
+	}
+
+	return data, nil
+}
+
+// yamlValue converts a YAML node into a generic value. Timestamps are kept as
+// written, so the ones without an offset aren't taken as UTC.
+func yamlValue(n *yaml.Node) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		return yamlValue(n.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(n.Alias)
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			v, err := yamlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		var merged []map[string]interface{}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			v, err := yamlValue(value)
+			if err != nil {
+				return nil, err
+			}
+			if key.ShortTag() != "!!merge" {
+				m[key.Value] = v
+				continue
+			}
+			switch t := v.(type) {
+			case map[string]interface{}:
+				merged = append(merged, t)
+			case []interface{}:
+				for _, item := range t {
+					if mm, ok := item.(map[string]interface{}); ok {
+						merged = append(merged, mm)
+					}
+				}
+			}
+		}
+		for _, mm := range merged {
+			for k, v := range mm {
+				if _, ok := m[k]; !ok {
+					m[k] = v
+				}
+			}
+		}
+		return m, nil
+	default:
+		if n.ShortTag() == "!!timestamp" {
+			return n.Value, nil
+		}
+		var v interface{}
+		err := n.Decode(&v)
+		return v, err
+	}
+}
+
+// decodeError is an error decoding the setting at the given key of the
+// config, a dotted path like `services.api.timeout`.
+type decodeError struct {
+	key string
+	msg string
+}
+
+func (e *decodeError) Error() string {
+	return fmt.Sprintf("Invalid `%s`: %s", e.key, e.msg)
+}
+
+var (
+	keyError  = regexp.MustCompile(`^toml: (?:line \d+ )?\(last key ("(?:[^"\\]|\\.)*")\): (.*)$`)
+	typeError = regexp.MustCompile(`^incompatible types: TOML value has type (.+); destination has type (.+)$`)
+	typeNames = map[string]string{
+		"string":                  "text",
+		"int64":                   "an integer",
+		"float64":                 "a number",
+		"bool":                    "a boolean",
+		"time.Time":               "a datetime",
+		"[]interface {}":          "a list",
+		"map[string]interface {}": "a table",
+	}
+)
+
+// decodeErr rewrites an error decoding the config transcoded to TOML, which
+// refers to lines of the transcoded text, in terms of the key of the setting,
+// so it makes sense whatever the format the config is written in.
+func decodeErr(err error) error {
+	m := keyError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "toml: "))
+	}
+	key, uerr := strconv.Unquote(m[1])
+	if uerr != nil {
+		key = m[1]
+	}
+	msg := m[2]
+	if t := typeError.FindStringSubmatch(msg); t != nil {
+		got, ok := typeNames[t[1]]
+		if !ok {
+			got = t[1]
+		}
+		msg = fmt.Sprintf("got %s, want %s", got, strings.TrimSuffix(t[2], " (string-like)"))
+	}
+	return &decodeError{key: key, msg: msg}
+}
+
+// transcode encodes a generic document as TOML.
+func transcode(data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// jsonNumbers walks a decoded JSON document converting every json.Number into
+// an int64, or a float64 if it's not an integer.
+func jsonNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, item := range t {
+			t[k] = jsonNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range t {
+			t[i] = jsonNumbers(item)
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
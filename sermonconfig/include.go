@@ -0,0 +1,166 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	includeKey  = "include"
+	servicesKey = "services"
+)
+
+// loadFile reads a config file and decodes it into a generic document. If
+// format is empty, it's detected from the file extension.
+func loadFile(path string, format Format) (map[string]interface{}, error) {
+	if format == "" {
+		var err error
+		format, err = FormatFromPath(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := decode(string(content), format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// serviceOrigins maps the name of every service in a document to the file
+// where it's defined, to be able to report duplicates.
+func serviceOrigins(data map[string]interface{}, path string) map[string]string {
+	origins := map[string]string{}
+	services, _ := data[servicesKey].(map[string]interface{})
+	for name := range services {
+		origins[name] = path
+	}
+	return origins
+}
+
+// keyOrigin returns the file the setting at the given key comes from: the
+// one defining the service, for settings of services, or the main one.
+func keyOrigin(key string, path string, origins map[string]string) string {
+	for name, origin := range origins {
+		for _, prefix := range []string{servicesKey + "." + name + ".", servicesKey + "." + strconv.Quote(name) + "."} {
+			if strings.HasPrefix(key, prefix) {
+				return origin
+			}
+		}
+	}
+	return path
+}
+
+// resolveIncludes merges the services of every file matching the `include`
+// globs into the document. Relative globs are resolved from baseDir.
+func resolveIncludes(data map[string]interface{}, baseDir string, origins map[string]string) error {
+	raw, ok := data[includeKey]
+	if !ok {
+		return nil
+	}
+	delete(data, includeKey)
+
+	patterns, ok := raw.([]interface{})
+	if !ok {
+		return fmt.Errorf("Invalid `include`, want a list of globs")
+	}
+
+	for _, p := range patterns {
+		pattern, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("Invalid `include` glob: %v", p)
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid `include` glob %s: %w", pattern, err)
+		}
+
+		for _, path := range paths {
+			err = includeFile(data, path, origins)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// includeDir merges the services of every config file in dir into the document.
+func includeDir(data map[string]interface{}, dir string, origins map[string]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if _, err := FormatFromPath(entry.Name()); err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		err = includeFile(data, path, origins)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// includeFile merges the services defined in the given file into the document.
+func includeFile(data map[string]interface{}, path string, origins map[string]string) error {
+	included, err := loadFile(path, "")
+	if err != nil {
+		return err
+	}
+
+	for key := range included {
+		if key != servicesKey {
+			return fmt.Errorf("Only `services` can be defined in included file %s, found `%s`", path, key)
+		}
+	}
+
+	services, ok := included[servicesKey].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	resolvePaths(included, filepath.Dir(path))
+
+	merged, ok := data[servicesKey].(map[string]interface{})
+	if !ok {
+		merged = map[string]interface{}{}
+		data[servicesKey] = merged
+	}
+
+	for name, service := range services {
+		if origin, ok := origins[name]; ok {
+			return fmt.Errorf("Duplicate service %s, defined in %s and %s", name, origin, path)
+		}
+		origins[name] = path
+		merged[name] = service
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package sermonconfig
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/cron"
+)
+
+// Schedule is a cron-like schedule, ie: `0 3 * * 0` is every Sunday at 3am.
+type Schedule struct {
+	Spec string
+	*cron.Schedule
+}
+
+func (s *Schedule) UnmarshalText(text []byte) error {
+	var err error
+	s.Spec = string(text)
+	s.Schedule, err = cron.Parse(s.Spec)
+	return err
+}
+
+// Timezone is a location from the IANA time zone database, ie: `Europe/Berlin`.
+type Timezone struct {
+	*time.Location
+}
+
+func (tz *Timezone) UnmarshalText(text []byte) error {
+	var err error
+	tz.Location, err = time.LoadLocation(string(text))
+	if err != nil {
+		return fmt.Errorf("Invalid timezone %q", text)
+	}
+	return nil
+}
+
+// Maintenance is a period in which notifications about some services are
+// suppressed. It's either one-off, from `start` to `end`, or recurring, for
+// `duration` every time the `schedule` matches.
+type Maintenance struct {
+	// Services and Tags scope the maintenance, it applies to the services
+	// listed and the ones with any of the tags.
+	Services []string
+	Tags     []string
+	Start    time.Time
+	End      time.Time
+	Schedule *Schedule
+	Duration Duration
+	// Timezone is the one the schedule is in, UTC by default.
+	Timezone Timezone
+	Reason   string
+}
+
+// Covers checks if the maintenance applies to a service.
+func (m *Maintenance) Covers(name string, tags []string) bool {
+	if contains(m.Services, name) {
+		return true
+	}
+	for _, tag := range tags {
+		if contains(m.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Active checks if the maintenance is taking place at time t.
+func (m *Maintenance) Active(t time.Time) bool {
+	if m.Schedule == nil {
+		return !t.Before(m.Start) && t.Before(m.End)
+	}
+
+	loc := time.UTC
+	if m.Timezone.Location != nil {
+		loc = m.Timezone.Location
+	}
+	return !m.Schedule.Since(t.In(loc), m.Duration.Duration).IsZero()
+}
+
+// validate checks the maintenance is either one-off or recurring, and is
+// scoped to some services.
+func (m *Maintenance) validate(services map[string]bool) error {
+	if len(m.Services) == 0 && len(m.Tags) == 0 {
+		return errors.New("Missing `services` or `tags` in `maintenance`")
+	}
+	for _, name := range m.Services {
+		if !services[name] {
+			return fmt.Errorf("Unknown service %s in `maintenance`", name)
+		}
+	}
+
+	if m.Schedule != nil {
+		if !m.Start.IsZero() || !m.End.IsZero() {
+			return errors.New("Invalid `maintenance`, it has both a `schedule` and `start` or `end`")
+		}
+		if m.Duration.Duration <= 0 {
+			return fmt.Errorf("Missing `duration` in `maintenance` with schedule %q", m.Schedule.Spec)
+		}
+		return nil
+	}
+
+	if m.Start.IsZero() || m.End.IsZero() {
+		return errors.New("Missing `schedule`, or `start` and `end`, in `maintenance`")
+	}
+	if !m.End.After(m.Start) {
+		return fmt.Errorf("Invalid `maintenance`, `end` %s is not after `start` %s", m.End, m.Start)
+	}
+	return nil
+}
+
+// ActiveMaintenance returns the maintenance of a service taking place at time
+// t, or nil if there's none.
+func (c *Config) ActiveMaintenance(name string, tags []string, t time.Time) *Maintenance {
+	for i := range c.Maintenance {
+		m := &c.Maintenance[i]
+		if m.Covers(name, tags) && m.Active(t) {
+			return m
+		}
+	}
+	return nil
+}
+
+// localLayouts are the layouts of datetimes without an offset.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+
+// localTimes sets the timezone of the `start` and `end` of the maintenance
+// windows in the document that are written without an offset, to the
+// `timezone` of the window, UTC by default, whatever the format of the config.
+func localTimes(data map[string]interface{}) {
+	var windows []map[string]interface{}
+	switch w := data["maintenance"].(type) {
+	case []map[string]interface{}:
+		windows = w
+	case []interface{}:
+		for _, item := range w {
+			if window, ok := item.(map[string]interface{}); ok {
+				windows = append(windows, window)
+			}
+		}
+	}
+
+	for _, window := range windows {
+		loc := time.UTC
+		if name, ok := window["timezone"].(string); ok && name != "" {
+			var err error
+			// An invalid timezone is reported when decoding the window.
+			if loc, err = time.LoadLocation(name); err != nil {
+				continue
+			}
+		}
+
+		for _, key := range []string{"start", "end"} {
+			if t, ok := inLocation(window[key], loc); ok {
+				window[key] = t
+			}
+		}
+	}
+}
+
+// inLocation returns a datetime without an offset, either decoded as a local
+// one or as text, in the given location.
+func inLocation(v interface{}, loc *time.Location) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		if name := t.Location().String(); name == "datetime-local" || name == "date-local" {
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc), true
+		}
+	case string:
+		for _, layout := range localLayouts {
+			if parsed, err := time.ParseInLocation(layout, t, loc); err == nil {
+				return parsed, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,106 @@
+package sermonconfig
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+type AttachmentFormat struct {
+	Format string
+}
+
+func (a *AttachmentFormat) UnmarshalText(text []byte) error {
+	switch format := string(text); format {
+	case "json", "csv":
+		a.Format = format
+		return nil
+	default:
+		return fmt.Errorf("Invalid attachment format (json or csv): %s", text)
+	}
+}
+
+// Template is a text/template given inline in the config.
+type Template struct {
+	Text string
+}
+
+func (t *Template) UnmarshalText(text []byte) error {
+	_, err := template.New("template").Parse(string(text))
+	if err != nil {
+		return fmt.Errorf("Invalid template: %w", err)
+	}
+	t.Text = string(text)
+	return nil
+}
+
+// TemplateFile is a template read from a file. Relative paths are resolved
+// from the directory of the config file, or from the working directory if the
+// config isn't read from a file.
+type TemplateFile struct {
+	Path    string
+	Content string
+}
+
+func (t *TemplateFile) UnmarshalText(text []byte) error {
+	content, err := os.ReadFile(string(text))
+	if err != nil {
+		return fmt.Errorf("Unable to read template: %w", err)
+	}
+	t.Path = string(text)
+	t.Content = string(content)
+	return nil
+}
+
+// templateFileKeys are the settings of `notifications.email` that are paths
+// to template files.
+var templateFileKeys = []string{"text_template", "html_template"}
+
+// resolveTemplateFiles makes the relative paths to template files in the
+// document relative to baseDir.
+func resolveTemplateFiles(data map[string]interface{}, baseDir string) {
+	notifications, _ := data["notifications"].(map[string]interface{})
+	email, _ := notifications["email"].(map[string]interface{})
+	for _, key := range templateFileKeys {
+		if path, ok := email[key].(string); ok && path != "" && !filepath.IsAbs(path) {
+			email[key] = filepath.Join(baseDir, path)
+		}
+	}
+}
+
+// EmailNotifications holds the settings of email reports.
+type EmailNotifications struct {
+	// Attachment is the format of the full report attached to emails, there's
+	// no attachment if it's empty.
+	Attachment AttachmentFormat
+	// Subject is the template of the subject of emails.
+	Subject Template
+	// TextTemplate and HTMLTemplate are the templates of the plain text and
+	// the HTML versions of emails.
+	TextTemplate TemplateFile `toml:"text_template"`
+	HTMLTemplate TemplateFile `toml:"html_template"`
+}
+
+// validate checks the email templates can be parsed.
+func (e *EmailNotifications) validate() error {
+	if e.TextTemplate.Path != "" {
+		_, err := template.New("text").Parse(e.TextTemplate.Content)
+		if err != nil {
+			return fmt.Errorf("Invalid template %s: %w", e.TextTemplate.Path, err)
+		}
+	}
+	if e.HTMLTemplate.Path != "" {
+		_, err := htmltemplate.New("html").Parse(e.HTMLTemplate.Content)
+		if err != nil {
+			return fmt.Errorf("Invalid template %s: %w", e.HTMLTemplate.Path, err)
+		}
+	}
+	return nil
+}
+
+// Notifications holds the settings of every notifier.
+type Notifications struct {
+	Email EmailNotifications
+}
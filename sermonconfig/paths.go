@@ -0,0 +1,66 @@
+package sermonconfig
+
+import (
+	"path/filepath"
+
+	"gitlab.com/germandv/sermon/internal/interpolate"
+)
+
+// serviceFileKeys are the keys of the settings of services, ie: of their TLS
+// connection, that are paths to files.
+var serviceFileKeys = []string{"cert_file", "key_file", "ca_file"}
+
+// resolvePaths makes the relative paths to files in the document, and the ones
+// of its `${file:...}` references, relative to baseDir, the directory of the
+// file it was read from.
+func resolvePaths(data map[string]interface{}, baseDir string) {
+	resolveTemplateFiles(data, baseDir)
+
+	smtp, _ := data["smtp"].(map[string]interface{})
+	resolveFileKeys(smtp, []string{"ca_file"}, baseDir)
+
+	defaults, _ := data[defaultsKey].(map[string]interface{})
+	resolveFileKeys(defaults, serviceFileKeys, baseDir)
+	for _, key := range []string{servicesKey, templatesKey} {
+		tables, _ := data[key].(map[string]interface{})
+		for _, t := range tables {
+			table, _ := t.(map[string]interface{})
+			resolveFileKeys(table, serviceFileKeys, baseDir)
+		}
+	}
+
+	rebaseReferences(data, baseDir)
+}
+
+// resolveFileKeys makes the relative paths at the given keys of the table
+// relative to baseDir.
+func resolveFileKeys(table map[string]interface{}, keys []string, baseDir string) {
+	for _, key := range keys {
+		if path, ok := table[key].(string); ok && path != "" && !filepath.IsAbs(path) {
+			table[key] = filepath.Join(baseDir, path)
+		}
+	}
+}
+
+// rebaseReferences makes the relative paths of the `${file:...}` references
+// in every text of the value relative to baseDir. Tables and arrays are
+// updated in place, the updated value is returned.
+func rebaseReferences(value interface{}, baseDir string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return interpolate.Rebase(v, baseDir)
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = rebaseReferences(item, baseDir)
+		}
+	case []map[string]interface{}:
+		for _, item := range v {
+			rebaseReferences(item, baseDir)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = rebaseReferences(item, baseDir)
+		}
+	}
+	return value
+}
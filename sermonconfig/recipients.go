@@ -0,0 +1,67 @@
+package sermonconfig
+
+import (
+	"errors"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// Recipients lists the addresses an email report is sent to.
+type Recipients struct {
+	To  []Email
+	CC  []Email
+	BCC []Email
+}
+
+// Empty checks if there are no recipients at all.
+func (r *Recipients) Empty() bool {
+	return len(r.To) == 0 && len(r.CC) == 0 && len(r.BCC) == 0
+}
+
+// Route sends the part of the report about the services it matches to its own
+// recipients. A route matches services with its severity, if set, and any of
+// its tags, if set.
+type Route struct {
+	Severity sermoncore.Severity
+	Tags     []string
+	Recipients
+}
+
+// Match checks if the route matches the given service.
+func (r *Route) Match(ss *sermoncore.ServiceStatus) bool {
+	if r.Severity.Level != "" && r.Severity.Level != ss.Severity {
+		return false
+	}
+	if len(r.Tags) > 0 && !ss.HasTag(r.Tags...) {
+		return false
+	}
+	return true
+}
+
+// DefaultRecipients returns the recipients of the services not matched by any
+// route, which are the ones in `recipients` plus the `email` address.
+func (c *Config) DefaultRecipients() Recipients {
+	recipients := c.Recipients
+	if c.Email.Address != "" {
+		recipients.To = append([]Email{c.Email}, recipients.To...)
+	}
+	return recipients
+}
+
+// validateRecipients checks there's someone to send reports to.
+func (c *Config) validateRecipients() error {
+	if c.Email.Address == "" && len(c.Recipients.To) == 0 {
+		return errors.New("Missing `email`, or `to` in `recipients`")
+	}
+
+	for _, route := range c.Routes {
+		if route.Empty() {
+			return errors.New("Missing `to`, `cc` or `bcc` in `routes`")
+		}
+		if route.Severity.Level == "" && len(route.Tags) == 0 {
+			return errors.New("Missing `severity` or `tags` in `routes`")
+		}
+	}
+
+	return nil
+}
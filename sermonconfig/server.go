@@ -0,0 +1,45 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"net"
+)
+
+const DefaultListen = "127.0.0.1:8080"
+
+// Server holds the settings of the admin API served by `sermon serve`.
+type Server struct {
+	// Listen is the address to listen on, `127.0.0.1:8080` by default.
+	Listen string
+	// Token is required as a bearer token by the admin API. It can only be
+	// left out if the server listens on a loopback address.
+	Token Secret
+}
+
+// setDefaults sets the default value of the settings that are not set.
+func (s *Server) setDefaults() {
+	if s.Listen == "" {
+		s.Listen = DefaultListen
+	}
+}
+
+func (s *Server) validate() error {
+	host, _, err := net.SplitHostPort(s.Listen)
+	if err != nil {
+		return fmt.Errorf("Invalid `listen` in `server`: %w", err)
+	}
+	if s.Token.Value.Expose() == "" && !isLoopback(host) {
+		return fmt.Errorf("Missing `token` in `server`, needed to listen on %s, which is not a loopback address", s.Listen)
+	}
+	return nil
+}
+
+// isLoopback checks if the host only accepts connections from the same
+// machine.
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,61 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultSLAWindow         = 30 * 24 * time.Hour
+	DefaultBurnRateWindow    = time.Hour
+	DefaultBurnRateThreshold = 14.4
+)
+
+// SLA holds the settings to compute the availability of services with an
+// `slo`, and alert when their error budget is being used up too quickly.
+type SLA struct {
+	// Window is the period the SLO applies to, 30 days by default.
+	Window Duration
+	// BurnRateWindow is the recent period the burn rate is computed over
+	// after every run, 1 hour by default.
+	BurnRateWindow Duration `toml:"burn_rate_window"`
+	// BurnRateThreshold is the burn rate that triggers an alert, 14.4 by
+	// default, which uses up 2% of a 30 days budget in an hour.
+	BurnRateThreshold float64 `toml:"burn_rate_threshold"`
+	// BurnRateCooldown is how long to wait before alerting again about the
+	// same services, the burn rate window by default.
+	BurnRateCooldown Duration `toml:"burn_rate_cooldown"`
+}
+
+// setDefaults sets the default value of the settings that are not set.
+func (s *SLA) setDefaults() {
+	if s.Window.Duration == 0 {
+		s.Window.Duration = DefaultSLAWindow
+	}
+	if s.BurnRateWindow.Duration == 0 {
+		s.BurnRateWindow.Duration = DefaultBurnRateWindow
+	}
+	if s.BurnRateThreshold == 0 {
+		s.BurnRateThreshold = DefaultBurnRateThreshold
+	}
+	if s.BurnRateCooldown.Duration == 0 {
+		s.BurnRateCooldown.Duration = s.BurnRateWindow.Duration
+	}
+}
+
+// validate checks the SLA settings are valid.
+func (s *SLA) validate() error {
+	if s.Window.Duration < 0 {
+		return fmt.Errorf("Invalid `window` in `sla`: %s", s.Window.Duration)
+	}
+	if s.BurnRateWindow.Duration < 0 {
+		return fmt.Errorf("Invalid `burn_rate_window` in `sla`: %s", s.BurnRateWindow.Duration)
+	}
+	if s.BurnRateThreshold < 0 {
+		return fmt.Errorf("Invalid `burn_rate_threshold` in `sla`: %v", s.BurnRateThreshold)
+	}
+	if s.BurnRateCooldown.Duration < 0 {
+		return fmt.Errorf("Invalid `burn_rate_cooldown` in `sla`: %s", s.BurnRateCooldown.Duration)
+	}
+	return nil
+}
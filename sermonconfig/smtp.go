@@ -0,0 +1,74 @@
+package sermonconfig
+
+import (
+	"fmt"
+
+	"gitlab.com/germandv/sermon/internal/interpolate"
+	"gitlab.com/germandv/sermon/internal/secret"
+)
+
+type TLSMode struct {
+	Mode string
+}
+
+func (t *TLSMode) UnmarshalText(text []byte) error {
+	switch mode := string(text); mode {
+	case "none", "starttls", "implicit":
+		t.Mode = mode
+		return nil
+	default:
+		return fmt.Errorf("Invalid TLS mode (none, starttls or implicit): %s", text)
+	}
+}
+
+// Secret is a config value that may reference env vars or files, it's always
+// kept secret.
+type Secret struct {
+	Value secret.Secret[string]
+}
+
+func (s *Secret) UnmarshalText(text []byte) error {
+	resolved, _, err := interpolate.Expand(string(text))
+	if err != nil {
+		return err
+	}
+	s.Value = secret.New(resolved)
+	return nil
+}
+
+// SMTP holds the settings of the email server used to send reports. When it's
+// not set, settings are read from the `EMAIL_*` env vars.
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password Secret
+	// From is the sender address, it defaults to the username.
+	From               Email
+	TLSMode            TLSMode `toml:"tls_mode"`
+	CAFile             string  `toml:"ca_file"`
+	InsecureSkipVerify bool    `toml:"insecure_skip_verify"`
+}
+
+// validate checks the SMTP settings are complete, if they are set at all.
+func (s *SMTP) validate() error {
+	if s.Host == "" {
+		return fmt.Errorf("Missing `host` in `smtp`")
+	}
+	if s.Port < 0 || s.Port > 65535 {
+		return fmt.Errorf("Invalid `port` in `smtp`: %d", s.Port)
+	}
+	if s.Username == "" && s.From.Address == "" {
+		return fmt.Errorf("Missing `from` in `smtp`, it's required when there's no `username`")
+	}
+	if s.Username != "" && s.TLSMode.Mode == "none" && !isLocalhost(s.Host) {
+		return fmt.Errorf("Invalid `tls_mode` in `smtp`, credentials are only sent over a plain connection to localhost, not to %s", s.Host)
+	}
+	return nil
+}
+
+// isLocalhost checks if the host is one credentials can be sent to over a
+// plain connection.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
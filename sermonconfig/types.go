@@ -0,0 +1,144 @@
+package sermonconfig
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// validateCheck checks a service has the settings its type needs.
+func validateCheck(name string, s sermoncore.Service, stateDir string) error {
+	switch s.Type {
+	case "", sermoncore.TypeHTTP:
+		if s.Endpoint.URL == nil {
+			return fmt.Errorf("Missing `endpoint` for service %s", name)
+		}
+		if len(s.Codes) == 0 {
+			return fmt.Errorf("Missing `codes` for service %s", name)
+		}
+		if s.Timeout.Duration == time.Duration(0) {
+			return fmt.Errorf("Missing `timeout` for service %s", name)
+		}
+	case sermoncore.TypeHeartbeat:
+		if s.Token.Value.Expose() == "" {
+			return fmt.Errorf("Missing `token` for heartbeat service %s", name)
+		}
+		if s.Period.Duration <= 0 {
+			return fmt.Errorf("Missing `period` for heartbeat service %s", name)
+		}
+		if s.Grace.Duration < 0 {
+			return fmt.Errorf("Invalid `grace` for heartbeat service %s", name)
+		}
+		if stateDir == "" {
+			return fmt.Errorf("Missing `state_dir`, needed to keep the pings of heartbeat service %s", name)
+		}
+	case sermoncore.TypeScenario:
+		if len(s.Steps) == 0 {
+			return fmt.Errorf("Missing `steps` for scenario service %s", name)
+		}
+		if s.Timeout.Duration == time.Duration(0) {
+			return fmt.Errorf("Missing `timeout` for service %s", name)
+		}
+		if s.ExpectFinalURL.Regexp != nil {
+			return fmt.Errorf("Invalid `expect_final_url` for scenario service %s, steps are checked by their `codes` and `contains`", name)
+		}
+		if err := validateSteps(name, s); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Invalid `type` for service %s (http, heartbeat or scenario): %s", name, s.Type)
+	}
+	if s.MaxRedirects < 0 {
+		return fmt.Errorf("Invalid `max_redirects` for service %s: %d", name, s.MaxRedirects)
+	}
+	if s.SourceAddress.IP != nil && s.Interface != "" {
+		return fmt.Errorf("Invalid settings for service %s, set either `source_address` or `interface`", name)
+	}
+	if err := validateIPVersion(name, s); err != nil {
+		return err
+	}
+	if _, err := s.TLS.Config(); err != nil {
+		return fmt.Errorf("Invalid TLS settings for service %s: %w", name, err)
+	}
+	return nil
+}
+
+// validateIPVersion checks a service checked over an IP version isn't checked
+// through a proxy, which would connect to it over any, and that its source
+// address, if any, is of that IP version.
+func validateIPVersion(name string, s sermoncore.Service) error {
+	version := s.IPVersion.Version
+	if version != "" && s.Proxy.URL != nil {
+		return fmt.Errorf("Invalid settings for service %s, `ip_version` can't be used with a `proxy`", name)
+	}
+	if version == "" || s.SourceAddress.IP == nil {
+		return nil
+	}
+	if version == sermoncore.IPBoth {
+		return fmt.Errorf("Invalid settings for service %s, `source_address` can't be used with both IP versions", name)
+	}
+	isIPv4 := s.SourceAddress.IP.To4() != nil
+	if isIPv4 != (version == sermoncore.IPv4) {
+		return fmt.Errorf("Invalid `source_address` for service %s, it must be an IPv%s address", name, version)
+	}
+	return nil
+}
+
+// validateSteps checks every step of a scenario makes a valid request, asserts
+// its status and only uses variables extracted in the steps before it.
+func validateSteps(name string, s sermoncore.Service) error {
+	extracted := map[string]bool{}
+	for i, step := range s.Steps {
+		stepName := s.StepName(i)
+		if step.URL.Value.Expose() == "" {
+			return fmt.Errorf("Missing `url` for step %s of service %s", stepName, name)
+		}
+		if err := step.ValidURL(); err != nil {
+			return fmt.Errorf("Invalid `url` for step %s of service %s: %w", stepName, name, err)
+		}
+		if len(step.Codes) == 0 {
+			return fmt.Errorf("Missing `codes` for step %s of service %s", stepName, name)
+		}
+
+		templates := []sermoncore.Template{step.URL, step.Body}
+		for _, h := range step.Headers {
+			templates = append(templates, h)
+		}
+		for _, t := range templates {
+			for _, v := range t.Variables() {
+				if !extracted[v] {
+					return fmt.Errorf("Unknown variable `%s` in step %s of service %s", v, stepName, name)
+				}
+			}
+		}
+		for v := range step.Extract {
+			extracted[v] = true
+		}
+	}
+	return nil
+}
+
+// validateTokens checks no two heartbeat services share a token.
+func validateTokens(services map[string]sermoncore.Service) error {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]string{}
+	for _, name := range names {
+		s := services[name]
+		if !s.IsHeartbeat() {
+			continue
+		}
+		token := s.Token.Value.Expose()
+		if other, ok := seen[token]; ok && token != "" {
+			return fmt.Errorf("Heartbeat services %s and %s have the same `token`", other, name)
+		}
+		seen[token] = name
+	}
+	return nil
+}
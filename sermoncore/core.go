@@ -1,12 +1,19 @@
 package sermoncore
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"gitlab.com/germandv/sermon/internal/httpclient"
+	"gitlab.com/germandv/sermon/internal/interpolate"
+	"gitlab.com/germandv/sermon/internal/secret"
 )
 
 type Timeout struct {
@@ -19,14 +26,80 @@ func (t *Timeout) UnmarshalText(text []byte) error {
 	return err
 }
 
+// Endpoint is the URL to be checked. It may reference env vars or files
+// (`${ENV_VAR}`, `${file:/run/secrets/x}`), the resolved URL is only used to
+// make the request, everywhere else the endpoint is shown as written.
 type Endpoint struct {
-	URL *url.URL
+	URL  *url.URL
+	text string
+	// secrets are the resolved values of the references in the endpoint, by
+	// reference.
+	secrets map[string]string
 }
 
 func (e *Endpoint) UnmarshalText(text []byte) error {
-	var err error
-	e.URL, err = url.ParseRequestURI(string(text))
-	return err
+	resolved, secrets, err := interpolate.Resolve(string(text))
+	if err != nil {
+		return err
+	}
+	e.URL, err = url.ParseRequestURI(resolved)
+	if err != nil && len(secrets) > 0 {
+		return redact(err, string(text))
+	}
+	if err != nil {
+		return err
+	}
+	e.text = string(text)
+	e.secrets = secrets
+	return nil
+}
+
+// String returns the endpoint as written in the config, without resolving
+// references, so secrets are not leaked.
+func (e Endpoint) String() string {
+	if e.text != "" {
+		return e.text
+	}
+	if e.URL == nil {
+		return ""
+	}
+	return e.URL.String()
+}
+
+// RedactURL replaces the resolved values of the references in the endpoint
+// that appear in the given URL, ie: one it redirected to, with the references
+// as written in the config.
+func (e Endpoint) RedactURL(u string) string {
+	for ref, value := range e.secrets {
+		if value == "" {
+			continue
+		}
+		for _, v := range []string{value, url.QueryEscape(value), url.PathEscape(value)} {
+			u = strings.ReplaceAll(u, v, ref)
+		}
+	}
+	return u
+}
+
+// Redact replaces the URL in a *url.Error with the endpoint as written in the
+// config, so resolved secrets do not end up in error messages.
+func (e Endpoint) Redact(err error) error {
+	return redact(err, e.String())
+}
+
+// Header is the value of an HTTP header sent along with the health check
+// request. It may reference env vars or files, so it's always kept secret.
+type Header struct {
+	Value secret.Secret[string]
+}
+
+func (h *Header) UnmarshalText(text []byte) error {
+	resolved, _, err := interpolate.Expand(string(text))
+	if err != nil {
+		return err
+	}
+	h.Value = secret.New(resolved)
+	return nil
 }
 
 type StatusCode struct {
@@ -42,34 +115,285 @@ func (s *StatusCode) UnmarshalText(text []byte) error {
 	return nil
 }
 
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+)
+
+type Severity struct {
+	Level string
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch level := string(text); level {
+	case SeverityCritical, SeverityWarning:
+		s.Level = level
+		return nil
+	default:
+		return fmt.Errorf("Invalid severity (critical or warning): %s", text)
+	}
+}
+
+// String returns the severity level, services are critical by default.
+func (s Severity) String() string {
+	if s.Level == "" {
+		return SeverityCritical
+	}
+	return s.Level
+}
+
 // Service represents a web service which health is to be monitored.
 type Service struct {
-	Name     string
+	Name string
+	// Type is how the service is checked, `http` by default.
+	Type     string
 	Endpoint Endpoint
 	Codes    []StatusCode
 	Timeout  Timeout
+	Headers  map[string]Header
+	Tags     []string
+	Group    string
+	Severity Severity
+	// Description, Owner and the runbook and dashboard URLs help whoever
+	// is notified about the service to act on it.
+	Description  string
+	Owner        string
+	RunbookURL   string `toml:"runbook_url"`
+	DashboardURL string `toml:"dashboard_url"`
+	// SLO is the availability objective of the service as a percentage of
+	// passing checks, ie: 99.9. There's no objective if it's zero.
+	SLO float64 `toml:"slo"`
+	// FailThreshold is the number of consecutive failing runs before the
+	// service is DOWN, and RecoverThreshold the number of consecutive passing
+	// runs before it's UP again. Both are 1 by default.
+	FailThreshold    int `toml:"fail_threshold"`
+	RecoverThreshold int `toml:"recover_threshold"`
+	// DependsOn lists the services this one can't work without, failures
+	// caused by them are folded into theirs.
+	DependsOn []string `toml:"depends_on"`
+	// Token, Period and Grace are the settings of heartbeat services: they
+	// ping with their token and are down if they don't within period plus
+	// grace.
+	Token  Token
+	Period Period
+	Grace  Period
+	// Steps are the requests of scenario services, run in order.
+	Steps []Step
+	// FollowRedirects is true by default, up to MaxRedirects. ExpectFinalURL
+	// is a pattern the URL the request ends up at must match.
+	FollowRedirects *bool   `toml:"follow_redirects"`
+	MaxRedirects    int     `toml:"max_redirects"`
+	ExpectFinalURL  Pattern `toml:"expect_final_url"`
+	// TLS are the settings of the TLS connection, ie: a client certificate
+	// and a private CA for services behind a service mesh.
+	TLS
+	// Proxy is the proxy the service is checked through, the global one by
+	// default. SourceAddress, or the address of Interface, is the local
+	// address it's checked from.
+	Proxy         Proxy
+	SourceAddress SourceAddress `toml:"source_address"`
+	Interface     string
+	// ReuseConnections is true by default, so checks share pooled
+	// connections with other checks with the same connection settings. If
+	// false, every check opens a new connection.
+	ReuseConnections *bool `toml:"reuse_connections"`
+	// IPVersion is the IP version the service is checked over, with both
+	// it's checked over each of them and reported separately.
+	IPVersion IPVersion `toml:"ip_version"`
+
+	// baseName is the name of the service in the config when it's checked
+	// over both IP versions, and Name includes the version.
+	baseName string
 }
 
+// BaseName returns the name of the service in the config, ie: `api` for
+// `api (IPv6)`.
+func (s *Service) BaseName() string {
+	if s.baseName != "" {
+		return s.baseName
+	}
+	return s.Name
+}
+
+// ReusesConnections checks if the service is checked over pooled
+// connections.
+func (s *Service) ReusesConnections() bool {
+	return s.ReuseConnections == nil || *s.ReuseConnections
+}
+
+// HasTag checks if the service is tagged with any of the given tags.
+func (s *Service) HasTag(tags ...string) bool {
+	return hasAny(s.Tags, tags)
+}
+
+// States of a service tracked across runs.
+const (
+	StateUp       = "UP"
+	StateDown     = "DOWN"
+	StateFlapping = "FLAPPING"
+)
+
 // ServiceStatus contains information about a service after checking its health.
 type ServiceStatus struct {
-	Name    string
-	Healthy bool
-	Err     error
+	Name string `json:"name"`
+	// ConfigName is the name of the service in the config, which differs
+	// from Name for services checked over both IP versions, and IPVersion
+	// the version it was checked over, if restricted.
+	ConfigName string `json:"config_name,omitempty"`
+	IPVersion  string `json:"ip_version,omitempty"`
+	Healthy    bool   `json:"healthy"`
+	Err        error  `json:"-"`
+	Endpoint   string `json:"endpoint,omitempty"`
+	// Duration is how long the health check took.
+	Duration time.Duration `json:"-"`
+	// CertExpiry is when the TLS certificate of the service expires.
+	CertExpiry   time.Time `json:"-"`
+	Tags         []string  `json:"tags,omitempty"`
+	Group        string    `json:"group,omitempty"`
+	Severity     string    `json:"severity"`
+	Description  string    `json:"description,omitempty"`
+	Owner        string    `json:"owner,omitempty"`
+	RunbookURL   string    `json:"runbook_url,omitempty"`
+	DashboardURL string    `json:"dashboard_url,omitempty"`
+	// State is the state of the service across runs, it's empty if it's not
+	// tracked.
+	State string `json:"state,omitempty"`
+	// Maintenance is set if the service is in a maintenance window, or
+	// silenced, for the given reason.
+	Maintenance       bool     `json:"maintenance,omitempty"`
+	MaintenanceReason string   `json:"maintenance_reason,omitempty"`
+	DependsOn         []string `json:"depends_on,omitempty"`
+	// RootCause is the failing dependency the service is failing because
+	// of, if any.
+	RootCause string `json:"root_cause,omitempty"`
+	// Incident is the ID of the open incident of the service, and AckedBy
+	// who acknowledged it, if anyone.
+	Incident string `json:"incident,omitempty"`
+	AckedBy  string `json:"acked_by,omitempty"`
+	// Timing is how long each phase of the request of an HTTP check took.
+	Timing *Timing `json:"timing,omitempty"`
+	// Redirects are the URLs the request was redirected to, in order.
+	Redirects []string `json:"redirects,omitempty"`
+	// Steps are the results of the steps of a scenario service.
+	Steps []StepResult `json:"steps,omitempty"`
+}
+
+// BaseName returns the name of the service in the config, ie: `api` for
+// `api (IPv6)`.
+func (ss *ServiceStatus) BaseName() string {
+	if ss.ConfigName != "" {
+		return ss.ConfigName
+	}
+	return ss.Name
+}
+
+// Link returns the endpoint to link the service to, it's empty if the
+// endpoint references env vars or files, as only the references are known.
+func (ss *ServiceStatus) Link() string {
+	if strings.Contains(ss.Endpoint, "${") {
+		return ""
+	}
+	return ss.Endpoint
+}
+
+// MarshalJSON encodes the ServiceStatus as JSON, with the error as a string
+// and the duration in milliseconds.
+func (ss *ServiceStatus) MarshalJSON() ([]byte, error) {
+	type status ServiceStatus
+	var errMsg string
+	if ss.Err != nil {
+		errMsg = ss.Err.Error()
+	}
+	var certExpiry *time.Time
+	if !ss.CertExpiry.IsZero() {
+		certExpiry = &ss.CertExpiry
+	}
+	return json.Marshal(struct {
+		*status
+		Error      string     `json:"error,omitempty"`
+		DurationMs int64      `json:"duration_ms"`
+		CertExpiry *time.Time `json:"cert_expiry,omitempty"`
+	}{(*status)(ss), errMsg, ss.Duration.Milliseconds(), certExpiry})
+}
+
+// Alerting checks if the service should be notified about: it's down, not
+// under maintenance, not failing because of a dependency and its incident
+// hasn't been acknowledged.
+func (ss *ServiceStatus) Alerting() bool {
+	if ss.Maintenance || ss.RootCause != "" || ss.AckedBy != "" {
+		return false
+	}
+	return ss.Down()
+}
+
+// Down checks if the service is failing: it's unhealthy or, if its state is
+// tracked across runs, it's DOWN.
+func (ss *ServiceStatus) Down() bool {
+	if ss.State == "" {
+		return !ss.Healthy
+	}
+	return ss.State == StateDown
+}
+
+// HasTag checks if the service is tagged with any of the given tags.
+func (ss *ServiceStatus) HasTag(tags ...string) bool {
+	return hasAny(ss.Tags, tags)
+}
+
+// Sections returns the names of the report sections the service is listed
+// under: its group if it has one, otherwise its tags.
+func (ss *ServiceStatus) Sections() []string {
+	if ss.Group != "" {
+		return []string{ss.Group}
+	}
+	return ss.Tags
+}
+
+// Probe holds details about the request made to check the health of a service.
+type Probe struct {
+	StatusCode int
+	// CertExpiry is when the TLS certificate of the service expires, it's
+	// zero for plain HTTP.
+	CertExpiry time.Time
+	// Timing is how long each phase of the request took.
+	Timing Timing
+	// Redirects are the URLs the request was redirected to, in order, with
+	// the secrets of the endpoint redacted.
+	Redirects []string
+	// finalURL is the URL the request ended up at, if redirected, as is.
+	finalURL string
 }
 
 // Health makes an HTTP request to check the health of the service.
 func (s *Service) Health(client httpclient.HttpClient) error {
-	status, err := get(client, s.Endpoint)
+	_, err := s.Probe(client)
+	return err
+}
+
+// Probe makes an HTTP request to check the health of the service, and returns
+// details about it, even if the service is not healthy.
+func (s *Service) Probe(client httpclient.HttpClient) (*Probe, error) {
+	probe, err := get(client, s.Endpoint, s.Headers)
 	if err != nil {
-		return err
+		return probe, err
 	}
 
-	if !in(s.Codes, status) {
-		e := fmt.Errorf("Got status %d, want one of %v", status, s.Codes)
-		return e
+	if !in(s.Codes, probe.StatusCode) {
+		e := fmt.Errorf("Got status %d, want one of %v", probe.StatusCode, s.Codes)
+		return probe, e
 	}
 
-	return nil
+	if s.ExpectFinalURL.Regexp != nil {
+		final, shown := s.Endpoint.URL.String(), s.Endpoint.String()
+		if n := len(probe.Redirects); n > 0 {
+			final, shown = probe.finalURL, probe.Redirects[n-1]
+		}
+		if !s.ExpectFinalURL.MatchString(final) {
+			return probe, fmt.Errorf("Ended up at %s, want a URL matching %s", shown, s.ExpectFinalURL)
+		}
+	}
+
+	return probe, nil
 }
 
 // in checks if the given item is included in the given slice of items.
@@ -82,11 +406,75 @@ func in(items []StatusCode, item int) bool {
 	return false
 }
 
-// get makes a GET HTTP request and returns the response status code.
-func get(client httpclient.HttpClient, endpoint Endpoint) (int, error) {
-	resp, err := client.Get(endpoint.URL.String())
+// redirects returns the URLs of the redirects that led to the given request,
+// in order.
+func redirects(req *http.Request) []string {
+	var chain []string
+	for r := req; r != nil && r.Response != nil; r = r.Response.Request {
+		chain = append([]string{r.URL.String()}, chain...)
+	}
+	return chain
+}
+
+// hasAny checks if any of the wanted items is included in the given items.
+func hasAny(items []string, wanted []string) bool {
+	for _, w := range wanted {
+		for _, i := range items {
+			if i == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// get makes a GET HTTP request and returns the response status code, the
+// expiry of the certificate of the server and the timing of the request.
+func get(client httpclient.HttpClient, endpoint Endpoint, headers map[string]Header) (*Probe, error) {
+	probe := &Probe{}
+
+	req, err := http.NewRequest(http.MethodGet, endpoint.URL.String(), nil)
+	if err != nil {
+		return probe, endpoint.Redact(err)
+	}
+	for name, h := range headers {
+		req.Header.Set(name, h.Value.Expose())
+	}
+
+	tracer := newTracer(time.Now())
+	resp, err := client.Do(tracer.trace(req))
 	if err != nil {
-		return 0, err
+		probe.Timing = tracer.done()
+		return probe, endpoint.Redact(err)
+	}
+	defer resp.Body.Close()
+
+	probe.StatusCode = resp.StatusCode
+	probe.Redirects = redirects(resp.Request)
+	if n := len(probe.Redirects); n > 0 {
+		probe.finalURL = probe.Redirects[n-1]
 	}
-	return resp.StatusCode, nil
+	for i, u := range probe.Redirects {
+		probe.Redirects[i] = endpoint.RedactURL(u)
+	}
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		probe.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+
+	_, err = io.Copy(io.Discard, io.LimitReader(resp.Body, maxBody))
+	probe.Timing = tracer.done()
+	if err != nil {
+		return probe, endpoint.Redact(err)
+	}
+	return probe, nil
+}
+
+// redact replaces the URL in a *url.Error with the given one, so resolved
+// secrets do not end up in error messages.
+func redact(err error, u string) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = u
+	}
+	return err
 }
@@ -1,14 +1,21 @@
 package sermoncore
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"gitlab.com/germandv/sermon/expect"
 	"gitlab.com/germandv/sermon/internal/httpclient"
+	"gitlab.com/germandv/sermon/internal/secret"
 )
 
 func TestIn(t *testing.T) {
@@ -64,3 +71,114 @@ func TestHealthRequest(t *testing.T) {
 		expect.Contains(t, err.Error(), "Got status 502, want one of [{200}]")
 	})
 }
+
+func TestEndpointInterpolation(t *testing.T) {
+	t.Run("ResolvesEnvVarsButKeepsThemOutOfString", func(t *testing.T) {
+		t.Setenv("SERMON_TEST_TOKEN", "s3cr3t")
+		var e Endpoint
+		err := e.UnmarshalText([]byte("https://api.test/health?token=${SERMON_TEST_TOKEN}"))
+		expect.NoError(t, err)
+		expect.Equal(t, e.URL.Query().Get("token"), "s3cr3t")
+		expect.Equal(t, e.String(), "https://api.test/health?token=${SERMON_TEST_TOKEN}")
+	})
+
+	t.Run("ErrorWhenEnvVarIsNotSet", func(t *testing.T) {
+		var e Endpoint
+		err := e.UnmarshalText([]byte("https://api.test/${SERMON_TEST_UNSET}"))
+		expect.Contains(t, err.Error(), "SERMON_TEST_UNSET referenced in config is not set")
+	})
+
+	t.Run("ErrorDoesNotLeakResolvedValue", func(t *testing.T) {
+		t.Setenv("SERMON_TEST_HOST", "s3cr3t.host")
+		var e Endpoint
+		err := e.UnmarshalText([]byte("${SERMON_TEST_HOST}"))
+		expect.Contains(t, err.Error(), "${SERMON_TEST_HOST}")
+		expect.Equal(t, strings.Contains(err.Error(), "s3cr3t"), false)
+	})
+}
+
+func TestHeaderInterpolation(t *testing.T) {
+	t.Run("ReadsValueFromFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "token")
+		err := os.WriteFile(path, []byte("s3cr3t\n"), 0o600)
+		expect.NoError(t, err)
+
+		var h Header
+		err = h.UnmarshalText([]byte("Bearer ${file:" + path + "}"))
+		expect.NoError(t, err)
+		expect.Equal(t, h.Value.Expose(), "Bearer s3cr3t")
+		expect.Equal(t, strings.Contains(fmt.Sprint(h), "s3cr3t"), false)
+	})
+
+	t.Run("SendsHeadersWithRequest", func(t *testing.T) {
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer ts.Close()
+
+		url, _ := url.Parse("http://localhost:4000/health_check")
+		service := &Service{
+			Name:     "localhost",
+			Endpoint: Endpoint{URL: url},
+			Codes:    []StatusCode{{Code: 200}},
+			Timeout:  Timeout{Duration: 5 * time.Second},
+			Headers:  map[string]Header{"Authorization": {Value: secret.New("Bearer s3cr3t")}},
+		}
+
+		mockClient := httpclient.NewMock(ts.Client(), ts.URL)
+		err := service.Health(mockClient)
+		expect.NoError(t, err)
+	})
+}
+
+func TestAlerting(t *testing.T) {
+	t.Parallel()
+	expect.Equal(t, (&ServiceStatus{Healthy: false}).Alerting(), true)
+	expect.Equal(t, (&ServiceStatus{Healthy: true}).Alerting(), false)
+	expect.Equal(t, (&ServiceStatus{Healthy: false, State: StateUp}).Alerting(), false)
+	expect.Equal(t, (&ServiceStatus{Healthy: false, State: StateFlapping}).Alerting(), false)
+	expect.Equal(t, (&ServiceStatus{Healthy: true, State: StateDown}).Alerting(), true)
+}
+
+func TestProbeTiming(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("OK"))
+	}))
+	defer ts.Close()
+
+	url, _ := url.Parse(ts.URL)
+	service := &Service{Endpoint: Endpoint{URL: url}, Codes: []StatusCode{{200}}}
+	probe, err := service.Probe(httpclient.New(ts.Client()))
+	expect.NoError(t, err)
+
+	timing := probe.Timing
+	expect.Equal(t, timing.Connect > 0, true)
+	expect.Equal(t, timing.TLS > 0, true)
+	expect.Equal(t, timing.FirstByte >= 20*time.Millisecond, true)
+	expect.Equal(t, timing.Total >= timing.FirstByte, true)
+	expect.Contains(t, timing.String(), "DNS 0s, connect ")
+}
+
+func TestTracerIsSafeForConcurrentCallbacks(t *testing.T) {
+	tr := newTracer(time.Now())
+	req := tr.trace(httptest.NewRequest(http.MethodGet, "/", nil))
+	ct := httptrace.ContextClientTrace(req.Context())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ct.ConnectStart("tcp", "127.0.0.1:80")
+			ct.ConnectDone("tcp", "127.0.0.1:80", nil)
+		}()
+	}
+	timing := tr.done()
+	wg.Wait()
+	expect.Equal(t, timing.Total > 0, true)
+}
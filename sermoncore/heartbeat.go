@@ -0,0 +1,50 @@
+package sermoncore
+
+import (
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/duration"
+	"gitlab.com/germandv/sermon/internal/interpolate"
+	"gitlab.com/germandv/sermon/internal/secret"
+)
+
+// Types of services.
+const (
+	// TypeHTTP services are checked with an HTTP request, it's the default.
+	TypeHTTP = "http"
+	// TypeHeartbeat services ping sermon instead, they're down if they don't
+	// within their period.
+	TypeHeartbeat = "heartbeat"
+)
+
+// Period is a duration which, on top of the usual units, accepts a number of
+// days, ie: `1d`.
+type Period struct {
+	Duration time.Duration
+}
+
+func (p *Period) UnmarshalText(text []byte) error {
+	var err error
+	p.Duration, err = duration.Parse(string(text))
+	return err
+}
+
+// Token identifies a heartbeat service in its ping URL. It may reference env
+// vars or files, so it's always kept secret.
+type Token struct {
+	Value secret.Secret[string]
+}
+
+func (t *Token) UnmarshalText(text []byte) error {
+	resolved, _, err := interpolate.Expand(string(text))
+	if err != nil {
+		return err
+	}
+	t.Value = secret.New(resolved)
+	return nil
+}
+
+// IsHeartbeat checks if the service is a heartbeat one.
+func (s *Service) IsHeartbeat() bool {
+	return s.Type == TypeHeartbeat
+}
@@ -0,0 +1,165 @@
+package sermoncore
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+
+	"gitlab.com/germandv/sermon/internal/interpolate"
+)
+
+// ProxyDirect is the proxy setting of services that connect directly, even
+// if there's a global proxy.
+const ProxyDirect = "direct"
+
+// Proxy is the HTTP, HTTPS or SOCKS5 proxy checks go through, ie:
+// `socks5://egress:1080`. It may reference env vars or files, for the
+// credentials, so it's shown as written everywhere else.
+type Proxy struct {
+	URL *url.URL
+	// Direct is set for `direct`, so the global proxy is not used.
+	Direct bool
+	text   string
+}
+
+func (p *Proxy) UnmarshalText(text []byte) error {
+	if string(text) == ProxyDirect {
+		p.Direct = true
+		p.text = ProxyDirect
+		return nil
+	}
+
+	resolved, _, err := interpolate.Expand(string(text))
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(resolved)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("Invalid proxy (an http, https or socks5 URL, or direct): %s", text)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("Invalid proxy (an http, https or socks5 URL, or direct): %s", text)
+	}
+	p.URL = u
+	p.text = string(text)
+	return nil
+}
+
+// IsZero checks if the proxy is not set.
+func (p Proxy) IsZero() bool {
+	return p.URL == nil && !p.Direct
+}
+
+// String returns the proxy as written in the config, without resolving
+// references, so secrets are not leaked.
+func (p Proxy) String() string {
+	return p.text
+}
+
+// SourceAddress is the local IP address checks are made from.
+type SourceAddress struct {
+	IP net.IP
+}
+
+func (a *SourceAddress) UnmarshalText(text []byte) error {
+	a.IP = net.ParseIP(string(text))
+	if a.IP == nil {
+		return fmt.Errorf("Invalid source address: %s", text)
+	}
+	return nil
+}
+
+// SourceIP returns the local IP address to check the service from: its
+// `source_address`, or the address of its `interface` for its IP version,
+// preferring IPv4 if it's not set. It's nil if neither is set, so the address
+// is picked by the system.
+func (s *Service) SourceIP() (net.IP, error) {
+	if s.SourceAddress.IP != nil || s.Interface == "" {
+		return s.SourceAddress.IP, nil
+	}
+
+	iface, err := net.InterfaceByName(s.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("Unknown interface %s: %w", s.Interface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("Could not get the addresses of interface %s: %w", s.Interface, err)
+	}
+
+	var ip net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		isIPv4 := ipNet.IP.To4() != nil
+		if isIPv4 && s.IPVersion.Version != IPv6 {
+			return ipNet.IP, nil
+		}
+		if ip == nil && !isIPv4 && !ipNet.IP.IsLinkLocalUnicast() && s.IPVersion.Version != IPv4 {
+			ip = ipNet.IP
+		}
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("Interface %s has no addresses", s.Interface)
+	}
+	return ip, nil
+}
+
+// IP versions services are checked over.
+const (
+	IPv4   = "4"
+	IPv6   = "6"
+	IPBoth = "both"
+)
+
+// IPVersion is the IP version a service is checked over: 4, 6 or both. If
+// it's not set, either is used, as the system prefers.
+type IPVersion struct {
+	Version string
+}
+
+func (v *IPVersion) UnmarshalText(text []byte) error {
+	switch version := string(text); version {
+	case IPv4, IPv6, IPBoth:
+		v.Version = version
+		return nil
+	default:
+		return fmt.Errorf("Invalid IP version (4, 6 or both): %s", text)
+	}
+}
+
+// Network returns the network to dial for the IP version, `tcp4` or `tcp6`,
+// or an empty string if it's not restricted.
+func (v IPVersion) Network() string {
+	switch v.Version {
+	case IPv4:
+		return "tcp4"
+	case IPv6:
+		return "tcp6"
+	default:
+		return ""
+	}
+}
+
+// ByIPVersion returns the service checked separately over IPv4 and IPv6 if
+// its IP version is both, named ie: `api (IPv6)`. Otherwise it returns the
+// service as is.
+func (s Service) ByIPVersion() []Service {
+	if s.IPVersion.Version != IPBoth {
+		return []Service{s}
+	}
+
+	services := make([]Service, 0, 2)
+	for _, version := range []string{IPv4, IPv6} {
+		family := s
+		family.Name = fmt.Sprintf("%s (IPv%s)", s.Name, version)
+		family.baseName = s.Name
+		family.IPVersion = IPVersion{version}
+		services = append(services, family)
+	}
+	return services
+}
@@ -0,0 +1,100 @@
+package sermoncore
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/httpclient"
+)
+
+func TestProxy(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "sermon.test" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	var p Proxy
+	expect.NoError(t, p.UnmarshalText([]byte(proxy.URL)))
+
+	u, _ := url.Parse("http://sermon.test/health")
+	s := &Service{Endpoint: Endpoint{URL: u}, Codes: []StatusCode{{200}}, Proxy: p}
+	transport := httpclient.NewTransport(httpclient.Options{Proxy: s.Proxy.URL})
+	err := s.Health(httpclient.New(&http.Client{Transport: transport}))
+	expect.NoError(t, err)
+
+	expect.NoError(t, p.UnmarshalText([]byte("direct")))
+	expect.Equal(t, p.Direct, true)
+	expect.Equal(t, p.IsZero(), false)
+
+	err = p.UnmarshalText([]byte("egress:3128"))
+	expect.Contains(t, err.Error(), "Invalid proxy")
+}
+
+func TestSourceIP(t *testing.T) {
+	t.Run("UsesSourceAddress", func(t *testing.T) {
+		s := &Service{SourceAddress: SourceAddress{IP: net.ParseIP("10.0.0.5")}}
+		ip, err := s.SourceIP()
+		expect.NoError(t, err)
+		expect.Equal(t, ip.String(), "10.0.0.5")
+	})
+
+	t.Run("UsesAddressOfInterface", func(t *testing.T) {
+		var loopback string
+		ifaces, err := net.Interfaces()
+		expect.NoError(t, err)
+		for _, iface := range ifaces {
+			if iface.Flags&net.FlagLoopback != 0 {
+				loopback = iface.Name
+			}
+		}
+		if loopback == "" {
+			t.Skip("No loopback interface")
+		}
+
+		s := &Service{Interface: loopback}
+		ip, err := s.SourceIP()
+		expect.NoError(t, err)
+		expect.Equal(t, ip.IsLoopback(), true)
+	})
+
+	t.Run("ErrorWhenInterfaceIsUnknown", func(t *testing.T) {
+		s := &Service{Interface: "sermon0"}
+		_, err := s.SourceIP()
+		expect.Contains(t, err.Error(), "Unknown interface sermon0")
+	})
+
+	t.Run("NilWhenNotSet", func(t *testing.T) {
+		s := &Service{}
+		ip, err := s.SourceIP()
+		expect.NoError(t, err)
+		expect.Equal(t, ip == nil, true)
+	})
+}
+
+func TestByIPVersion(t *testing.T) {
+	s := Service{Name: "api", IPVersion: IPVersion{IPBoth}}
+	services := s.ByIPVersion()
+	expect.Equal(t, len(services), 2)
+	expect.Equal(t, services[0].Name, "api (IPv4)")
+	expect.Equal(t, services[0].IPVersion.Network(), "tcp4")
+	expect.Equal(t, services[1].Name, "api (IPv6)")
+	expect.Equal(t, services[1].IPVersion.Network(), "tcp6")
+	expect.Equal(t, services[1].BaseName(), "api")
+
+	s.IPVersion = IPVersion{IPv6}
+	expect.Equal(t, s.ByIPVersion()[0].Name, "api")
+
+	s = Service{Name: "api (IPv6)", IPVersion: IPVersion{IPBoth}}
+	expect.Equal(t, s.ByIPVersion()[1].BaseName(), "api (IPv6)")
+
+	err := s.IPVersion.UnmarshalText([]byte("5"))
+	expect.Contains(t, err.Error(), "Invalid IP version")
+}
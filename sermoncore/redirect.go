@@ -0,0 +1,43 @@
+package sermoncore
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// defaultMaxRedirects is how many redirects are followed if the service
+// doesn't set `max_redirects`.
+const defaultMaxRedirects = 10
+
+// Pattern is a regular expression.
+type Pattern struct {
+	*regexp.Regexp
+}
+
+func (p *Pattern) UnmarshalText(text []byte) error {
+	var err error
+	p.Regexp, err = regexp.Compile(string(text))
+	if err != nil {
+		return fmt.Errorf("Invalid pattern %q: %w", text, err)
+	}
+	return nil
+}
+
+// CheckRedirect applies the redirect policy of the service, it's meant to be
+// the CheckRedirect of the http.Client it's checked with. If redirects are not
+// followed, the redirect response itself is checked.
+func (s *Service) CheckRedirect(req *http.Request, via []*http.Request) error {
+	if s.FollowRedirects != nil && !*s.FollowRedirects {
+		return http.ErrUseLastResponse
+	}
+
+	limit := s.MaxRedirects
+	if limit == 0 {
+		limit = defaultMaxRedirects
+	}
+	if len(via) > limit {
+		return fmt.Errorf("Stopped after %d redirects", limit)
+	}
+	return nil
+}
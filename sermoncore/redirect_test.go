@@ -0,0 +1,85 @@
+package sermoncore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/httpclient"
+)
+
+func TestRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/health", http.RedirectHandler("/sso", http.StatusFound))
+	mux.Handle("/sso", http.RedirectHandler("/login", http.StatusFound))
+	mux.HandleFunc("/keep", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login?"+r.URL.RawQuery, http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Sign in"))
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	newService := func() *Service {
+		u, _ := url.Parse(ts.URL + "/health")
+		return &Service{Endpoint: Endpoint{URL: u}, Codes: []StatusCode{{200}}}
+	}
+	probe := func(s *Service) (*Probe, error) {
+		return s.Probe(httpclient.New(&http.Client{CheckRedirect: s.CheckRedirect}))
+	}
+
+	t.Run("RecordsRedirectChain", func(t *testing.T) {
+		p, err := probe(newService())
+		expect.NoError(t, err)
+		expect.Equal(t, len(p.Redirects), 2)
+		expect.Equal(t, p.Redirects[0], ts.URL+"/sso")
+		expect.Equal(t, p.Redirects[1], ts.URL+"/login")
+	})
+
+	t.Run("ChecksRedirectResponseWhenNotFollowing", func(t *testing.T) {
+		s := newService()
+		follow := false
+		s.FollowRedirects = &follow
+		s.Codes = []StatusCode{{302}}
+		p, err := probe(s)
+		expect.NoError(t, err)
+		expect.Equal(t, len(p.Redirects), 0)
+	})
+
+	t.Run("StopsAfterMaxRedirects", func(t *testing.T) {
+		s := newService()
+		s.MaxRedirects = 1
+		_, err := probe(s)
+		expect.Contains(t, err.Error(), "Stopped after 1 redirects")
+	})
+
+	t.Run("ErrorWhenFinalURLDoesNotMatch", func(t *testing.T) {
+		s := newService()
+		expect.NoError(t, s.ExpectFinalURL.UnmarshalText([]byte("/health$")))
+		_, err := probe(s)
+		expect.Equal(t, err.Error(), "Ended up at "+ts.URL+"/login, want a URL matching /health$")
+	})
+
+	t.Run("ChecksEndpointWhenNotRedirected", func(t *testing.T) {
+		s := newService()
+		follow := false
+		s.FollowRedirects = &follow
+		s.Codes = []StatusCode{{302}}
+		expect.NoError(t, s.ExpectFinalURL.UnmarshalText([]byte("/health$")))
+		_, err := probe(s)
+		expect.NoError(t, err)
+	})
+
+	t.Run("RedactsSecretsOfEndpoint", func(t *testing.T) {
+		t.Setenv("SERMON_TEST_TOKEN", "s3cr3t")
+		s := newService()
+		expect.NoError(t, s.Endpoint.UnmarshalText([]byte(ts.URL+"/keep?token=${SERMON_TEST_TOKEN}")))
+		expect.NoError(t, s.ExpectFinalURL.UnmarshalText([]byte("/health")))
+		p, err := probe(s)
+		expect.Equal(t, p.Redirects[0], ts.URL+"/login?token=${SERMON_TEST_TOKEN}")
+		expect.Equal(t, err.Error(), "Ended up at "+ts.URL+"/login?token=${SERMON_TEST_TOKEN}, want a URL matching /health")
+	})
+}
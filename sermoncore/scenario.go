@@ -0,0 +1,298 @@
+package sermoncore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/httpclient"
+	"gitlab.com/germandv/sermon/internal/interpolate"
+	"gitlab.com/germandv/sermon/internal/secret"
+)
+
+// TypeScenario services are checked with a sequence of HTTP requests, values
+// extracted from a response can be used in the following ones.
+const TypeScenario = "scenario"
+
+// maxBody is how much of a response is read to run assertions and extract
+// values from.
+const maxBody = 1 << 20
+
+var variable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Template is text in which `{{name}}` is replaced with the value of a
+// variable extracted in a previous step. It may reference env vars or files
+// too, so it's always kept secret.
+type Template struct {
+	Value secret.Secret[string]
+	text  string
+}
+
+func (t *Template) UnmarshalText(text []byte) error {
+	resolved, _, err := interpolate.Expand(string(text))
+	if err != nil {
+		return err
+	}
+	t.Value = secret.New(resolved)
+	t.text = string(text)
+	return nil
+}
+
+// String returns the template as written in the config, so secrets are not
+// leaked.
+func (t Template) String() string {
+	return t.text
+}
+
+// Variables returns the names of the variables used in the template.
+func (t Template) Variables() []string {
+	var names []string
+	for _, m := range variable.FindAllStringSubmatch(t.Value.Expose(), -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
+
+// Render replaces the variables in the template with their values.
+func (t Template) Render(vars map[string]string) string {
+	return variable.ReplaceAllStringFunc(t.Value.Expose(), func(m string) string {
+		return vars[variable.FindStringSubmatch(m)[1]]
+	})
+}
+
+// Extract is where the value of a variable comes from: `json:path.to.field`
+// for a field of the JSON response, or `header:Name` for a response header.
+type Extract struct {
+	Source string
+	Path   string
+}
+
+// Sources of extracted values.
+const (
+	ExtractJSON   = "json"
+	ExtractHeader = "header"
+)
+
+func (e *Extract) UnmarshalText(text []byte) error {
+	source, path, ok := strings.Cut(string(text), ":")
+	if !ok || path == "" || (source != ExtractJSON && source != ExtractHeader) {
+		return fmt.Errorf("Invalid extract (json:path or header:Name): %s", text)
+	}
+	e.Source = source
+	e.Path = path
+	return nil
+}
+
+// Step is one of the HTTP requests of a scenario.
+type Step struct {
+	Name string
+	// Method is GET by default.
+	Method  string
+	URL     Template `toml:"url"`
+	Headers map[string]Template
+	Body    Template
+	Codes   []StatusCode
+	// Contains is text the response body must include.
+	Contains string
+	// MaxDuration is how long the step may take, there's no limit if it's
+	// zero.
+	MaxDuration Timeout `toml:"max_duration"`
+	// Extract maps names of variables to where their values come from in the
+	// response.
+	Extract map[string]Extract
+}
+
+// StepResult is the outcome of running a step of a scenario.
+type StepResult struct {
+	Name     string        `json:"name"`
+	Err      error         `json:"-"`
+	Duration time.Duration `json:"-"`
+	// Timing is how long each phase of the request of the step took.
+	Timing *Timing `json:"timing,omitempty"`
+}
+
+// MarshalJSON encodes the StepResult as JSON, with the error as a string and
+// the durations in milliseconds.
+func (sr StepResult) MarshalJSON() ([]byte, error) {
+	type result StepResult
+	var errMsg string
+	if sr.Err != nil {
+		errMsg = sr.Err.Error()
+	}
+	return json.Marshal(struct {
+		result
+		Error      string `json:"error,omitempty"`
+		DurationMs int64  `json:"duration_ms"`
+	}{result(sr), errMsg, sr.Duration.Milliseconds()})
+}
+
+// IsScenario checks if the service is a scenario one.
+func (s *Service) IsScenario() bool {
+	return s.Type == TypeScenario
+}
+
+// StepName returns the name of the i-th step, or its position if it has none.
+func (s *Service) StepName(i int) string {
+	if s.Steps[i].Name != "" {
+		return s.Steps[i].Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// Scenario runs the steps of the service in order, stopping at the first one
+// that fails. It returns the result of every step that ran and an error
+// naming the step that broke, if any.
+func (s *Service) Scenario(client httpclient.HttpClient) ([]StepResult, *Probe, error) {
+	probe := &Probe{}
+	vars := map[string]string{}
+	results := make([]StepResult, 0, len(s.Steps))
+
+	for i, step := range s.Steps {
+		tracer := newTracer(time.Now())
+		p, err := step.run(client, tracer, vars)
+		timing := tracer.done()
+		result := StepResult{Name: s.StepName(i), Err: err, Duration: timing.Total, Timing: &timing}
+		if err == nil && step.MaxDuration.Duration > 0 && result.Duration > step.MaxDuration.Duration {
+			result.Err = fmt.Errorf("Took %s, want at most %s", result.Duration.Round(time.Millisecond), step.MaxDuration.Duration)
+		}
+		results = append(results, result)
+		if probe.CertExpiry.IsZero() {
+			probe.CertExpiry = p.CertExpiry
+		}
+		probe.StatusCode = p.StatusCode
+
+		if result.Err != nil {
+			return results, probe, fmt.Errorf("Step %s failed: %w", result.Name, result.Err)
+		}
+	}
+
+	return results, probe, nil
+}
+
+// run makes the request of the step, traced by the given tracer, checks its
+// assertions and extracts the variables from the response into vars.
+func (st Step) run(client httpclient.HttpClient, tracer *tracer, vars map[string]string) (*Probe, error) {
+	probe := &Probe{}
+
+	method := st.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if st.Body.Value.Expose() != "" {
+		body = strings.NewReader(st.Body.Render(vars))
+	}
+	req, err := http.NewRequest(strings.ToUpper(method), st.URL.Render(vars), body)
+	if err != nil {
+		return probe, redact(err, st.URL.String())
+	}
+	for name, h := range st.Headers {
+		req.Header.Set(name, h.Render(vars))
+	}
+
+	resp, err := client.Do(tracer.trace(req))
+	if err != nil {
+		return probe, redact(err, st.URL.String())
+	}
+	defer resp.Body.Close()
+
+	probe.StatusCode = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		probe.CertExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	if !in(st.Codes, resp.StatusCode) {
+		return probe, fmt.Errorf("Got status %d, want one of %v", resp.StatusCode, st.Codes)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
+	if err != nil {
+		return probe, redact(err, st.URL.String())
+	}
+	if st.Contains != "" && !strings.Contains(string(content), st.Contains) {
+		return probe, fmt.Errorf("Body does not contain %q", st.Contains)
+	}
+
+	for name, e := range st.Extract {
+		value, err := e.from(resp.Header, content)
+		if err != nil {
+			return probe, fmt.Errorf("Could not extract %s: %w", name, err)
+		}
+		vars[name] = value
+	}
+
+	return probe, nil
+}
+
+// from extracts the value from the headers or the body of a response.
+func (e Extract) from(header http.Header, body []byte) (string, error) {
+	if e.Source == ExtractHeader {
+		value := header.Get(e.Path)
+		if value == "" {
+			return "", fmt.Errorf("Missing header %s", e.Path)
+		}
+		return value, nil
+	}
+
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return "", errors.New("Body is not JSON")
+	}
+	return jsonPath(doc, e.Path)
+}
+
+// jsonPath looks up a dot separated path in a decoded JSON document, array
+// elements are referenced by index, ie: `items.0.id`.
+func jsonPath(doc any, path string) (string, error) {
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		switch v := current.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return "", fmt.Errorf("Missing field %s", path)
+			}
+			current = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return "", fmt.Errorf("Missing field %s", path)
+			}
+			current = v[i]
+		default:
+			return "", fmt.Errorf("Missing field %s", path)
+		}
+	}
+
+	switch v := current.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case nil:
+		return "", fmt.Errorf("Field %s is null", path)
+	default:
+		return "", fmt.Errorf("Field %s is not a value", path)
+	}
+}
+
+// ValidURL checks the URL of the step is valid, with its variables replaced
+// by placeholders.
+func (st Step) ValidURL() error {
+	placeholder := variable.ReplaceAllString(st.URL.Value.Expose(), "x")
+	if _, err := url.ParseRequestURI(placeholder); err != nil {
+		return redact(err, st.URL.String())
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package sermoncore
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/httpclient"
+)
+
+func template(t *testing.T, text string) Template {
+	t.Helper()
+	var tmpl Template
+	expect.NoError(t, tmpl.UnmarshalText([]byte(text)))
+	return tmpl
+}
+
+func newShop(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || string(body) != `{"user": "sermon"}` {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("X-Session", "s1")
+		w.Write([]byte(`{"data": {"tokens": [{"value": "t0k3n"}], "ttl": 60}}`))
+	})
+	mux.Handle("/old-login", http.RedirectHandler("/login", http.StatusMovedPermanently))
+	mux.HandleFunc("/sessions/s1/cart", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0k3n" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"items": []}`))
+	})
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newScenario(t *testing.T, url string) *Service {
+	t.Helper()
+	return &Service{
+		Name: "checkout",
+		Type: TypeScenario,
+		Steps: []Step{
+			{
+				Name:   "login",
+				Method: "post",
+				URL:    template(t, url+"/login"),
+				Body:   template(t, `{"user": "sermon"}`),
+				Codes:  []StatusCode{{200}},
+				Extract: map[string]Extract{
+					"token":   {Source: ExtractJSON, Path: "data.tokens.0.value"},
+					"session": {Source: ExtractHeader, Path: "X-Session"},
+				},
+			},
+			{
+				URL:      template(t, url+"/sessions/{{session}}/cart"),
+				Headers:  map[string]Template{"Authorization": template(t, "Bearer {{ token }}")},
+				Codes:    []StatusCode{{200}},
+				Contains: "items",
+			},
+		},
+	}
+}
+
+func TestScenario(t *testing.T) {
+	ts := newShop(t)
+	client := httpclient.New(ts.Client())
+
+	t.Run("PassesVariablesAlong", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		steps, probe, err := s.Scenario(client)
+		expect.NoError(t, err)
+		expect.Equal(t, len(steps), 2)
+		expect.Equal(t, steps[0].Name, "login")
+		expect.Equal(t, steps[1].Name, "#2")
+		expect.Equal(t, probe.StatusCode, 200)
+	})
+
+	t.Run("TimesEachStep", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		steps, _, err := s.Scenario(client)
+		expect.NoError(t, err)
+		for _, step := range steps {
+			expect.Equal(t, step.Timing != nil, true)
+			expect.Equal(t, step.Timing.FirstByte > 0, true)
+			expect.Equal(t, step.Timing.Total, step.Duration)
+		}
+
+		content, err := json.Marshal(steps[0])
+		expect.NoError(t, err)
+		expect.Contains(t, string(content), `"timing":{"dns_ms":`)
+	})
+
+	t.Run("AppliesRedirectPolicyToSteps", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		s.Steps = s.Steps[:1]
+		s.Steps[0].URL = template(t, ts.URL+"/old-login")
+		s.Steps[0].Codes = []StatusCode{{301}}
+		s.Steps[0].Extract = nil
+		follow := false
+		s.FollowRedirects = &follow
+		_, _, err := s.Scenario(httpclient.New(&http.Client{CheckRedirect: s.CheckRedirect}))
+		expect.NoError(t, err)
+	})
+
+	t.Run("NamesTheFailingStep", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		s.Steps[1].Contains = "checkout"
+		steps, _, err := s.Scenario(client)
+		expect.Equal(t, err.Error(), `Step #2 failed: Body does not contain "checkout"`)
+		expect.NoError(t, steps[0].Err)
+		expect.Contains(t, steps[1].Err.Error(), "checkout")
+	})
+
+	t.Run("StopsAtTheFirstFailure", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		s.Steps[0].Body = template(t, `{"user": "nobody"}`)
+		steps, _, err := s.Scenario(client)
+		expect.Equal(t, err.Error(), "Step login failed: Got status 401, want one of [{200}]")
+		expect.Equal(t, len(steps), 1)
+	})
+
+	t.Run("FailsWhenValueIsMissing", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		s.Steps[0].Extract["token"] = Extract{Source: ExtractJSON, Path: "data.tokens.1.value"}
+		_, _, err := s.Scenario(client)
+		expect.Equal(t, err.Error(), "Step login failed: Could not extract token: Missing field data.tokens.1.value")
+	})
+
+	t.Run("FailsWhenStepIsTooSlow", func(t *testing.T) {
+		s := newScenario(t, ts.URL)
+		s.Steps[0].MaxDuration = Timeout{Duration: time.Nanosecond}
+		_, _, err := s.Scenario(client)
+		expect.Equal(t, strings.HasPrefix(err.Error(), "Step login failed: Took"), true)
+	})
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]any{"a": []any{map[string]any{"b": true}}, "n": nil}
+
+	value, err := jsonPath(doc, "a.0.b")
+	expect.NoError(t, err)
+	expect.Equal(t, value, "true")
+
+	_, err = jsonPath(doc, "a")
+	expect.Equal(t, err.Error(), "Field a is not a value")
+
+	_, err = jsonPath(doc, "n")
+	expect.Equal(t, err.Error(), "Field n is null")
+}
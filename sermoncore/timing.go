@@ -0,0 +1,142 @@
+package sermoncore
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing is how long each phase of an HTTP request took. Phases that didn't
+// happen, ie: TLS for plain HTTP, or that didn't complete are zero.
+type Timing struct {
+	DNS       time.Duration
+	Connect   time.Duration
+	TLS       time.Duration
+	FirstByte time.Duration
+	// Total is the time from the start of the request until the whole
+	// response has been read.
+	Total time.Duration
+}
+
+// MarshalJSON encodes the Timing as JSON, with the durations in milliseconds.
+func (t Timing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		DNS       int64 `json:"dns_ms"`
+		Connect   int64 `json:"connect_ms"`
+		TLS       int64 `json:"tls_ms"`
+		FirstByte int64 `json:"first_byte_ms"`
+		Total     int64 `json:"total_ms"`
+	}{
+		t.DNS.Milliseconds(),
+		t.Connect.Milliseconds(),
+		t.TLS.Milliseconds(),
+		t.FirstByte.Milliseconds(),
+		t.Total.Milliseconds(),
+	})
+}
+
+// Phases returns the name and duration of each phase of the request, in
+// order.
+func (t Timing) Phases() []Phase {
+	return []Phase{
+		{"dns", t.DNS},
+		{"connect", t.Connect},
+		{"tls", t.TLS},
+		{"first_byte", t.FirstByte},
+		{"total", t.Total},
+	}
+}
+
+// Phase is the name and duration of one phase of a request.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// String formats the Timing as a list of phases, ie: `DNS 2ms, connect 10ms,
+// TLS 25ms, first byte 120ms, total 125ms`.
+func (t Timing) String() string {
+	parts := []string{
+		fmt.Sprintf("DNS %s", round(t.DNS)),
+		fmt.Sprintf("connect %s", round(t.Connect)),
+		fmt.Sprintf("TLS %s", round(t.TLS)),
+		fmt.Sprintf("first byte %s", round(t.FirstByte)),
+		fmt.Sprintf("total %s", round(t.Total)),
+	}
+	return strings.Join(parts, ", ")
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Millisecond)
+}
+
+// tracer records the Timing of a request. The trace callbacks may run
+// concurrently, ie: when dialing several addresses, and even after the
+// request is done, so the Timing is guarded and only read as a snapshot.
+type tracer struct {
+	mu     sync.Mutex
+	start  time.Time
+	timing Timing
+
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+func newTracer(start time.Time) *tracer {
+	return &tracer{start: start}
+}
+
+// trace returns the request with the callbacks that record its Timing.
+func (t *tracer) trace(req *http.Request) *http.Request {
+	ct := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.record(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.record(func() { t.timing.DNS = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			t.record(func() {
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.record(func() { t.timing.Connect = time.Since(t.connectStart) })
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.record(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				t.record(func() { t.timing.TLS = time.Since(t.tlsStart) })
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.record(func() { t.timing.FirstByte = time.Since(t.start) })
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+}
+
+func (t *tracer) record(fn func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn()
+}
+
+// done sets the total time of the request, and returns a snapshot of its
+// Timing.
+func (t *tracer) done() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timing.Total = time.Since(t.start)
+	return t.timing
+}
@@ -0,0 +1,109 @@
+package sermoncore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLS are the settings of the TLS connection to a service: a client
+// certificate, a CA bundle to verify the server with, a server name to use
+// for SNI and verification instead of the host of the endpoint, and the
+// minimum TLS version.
+type TLS struct {
+	CertFile   string     `toml:"cert_file"`
+	KeyFile    string     `toml:"key_file"`
+	CAFile     string     `toml:"ca_file"`
+	ServerName string     `toml:"server_name"`
+	MinVersion TLSVersion `toml:"min_version"`
+	// InsecureSkipVerify disables the verification of the certificate of
+	// the server, it's only meant for lab environments.
+	InsecureSkipVerify bool `toml:"insecure_skip_verify"`
+}
+
+// TLSVersion is a TLS version: 1.0, 1.1, 1.2 or 1.3.
+type TLSVersion struct {
+	Version uint16
+}
+
+func (v *TLSVersion) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "1.0":
+		v.Version = tls.VersionTLS10
+	case "1.1":
+		v.Version = tls.VersionTLS11
+	case "1.2":
+		v.Version = tls.VersionTLS12
+	case "1.3":
+		v.Version = tls.VersionTLS13
+	default:
+		return fmt.Errorf("Invalid TLS version (1.0, 1.1, 1.2 or 1.3): %s", text)
+	}
+	return nil
+}
+
+// IsZero checks if none of the settings is set, so the default TLS
+// configuration is used.
+func (t TLS) IsZero() bool {
+	return t == TLS{}
+}
+
+// Config loads the certificates and returns the TLS configuration, nil if
+// none of the settings is set.
+func (t TLS) Config() (*tls.Config, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		MinVersion:         t.MinVersion.Version,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("Both `cert_file` and `key_file` are needed for a client certificate")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid `ca_file`: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Invalid `ca_file`, no certificates found in %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// Revision identifies the current content of the certificate files by their
+// modification times, so configurations loaded from them can be reloaded
+// when they change.
+func (t TLS) Revision() (string, error) {
+	var sb strings.Builder
+	for _, path := range []string{t.CertFile, t.KeyFile, t.CAFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(fmt.Sprintf("%s@%d;", path, info.ModTime().UnixNano()))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,93 @@
+package sermoncore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/httpclient"
+)
+
+func TestTLS(t *testing.T) {
+	clientCA, err := os.ReadFile("../testdata/tls/ca.pem")
+	expect.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(clientCA)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	expect.NoError(t, os.WriteFile(caFile, serverCA, 0o600))
+
+	u, _ := url.Parse(ts.URL)
+	probe := func(settings TLS) error {
+		config, err := settings.Config()
+		if err != nil {
+			return err
+		}
+		s := &Service{Endpoint: Endpoint{URL: u}, Codes: []StatusCode{{200}}, TLS: settings}
+		transport := httpclient.NewTransport(httpclient.Options{TLS: config})
+		return s.Health(httpclient.New(&http.Client{Transport: transport}))
+	}
+
+	t.Run("SendsClientCertificate", func(t *testing.T) {
+		err := probe(TLS{
+			CertFile:   "../testdata/tls/client.pem",
+			KeyFile:    "../testdata/tls/client.key",
+			CAFile:     caFile,
+			ServerName: "example.com",
+		})
+		expect.NoError(t, err)
+	})
+
+	t.Run("ErrorWithoutClientCertificate", func(t *testing.T) {
+		err := probe(TLS{CAFile: caFile})
+		expect.Equal(t, err != nil, true)
+	})
+
+	t.Run("ErrorWhenServerIsNotTrusted", func(t *testing.T) {
+		err := probe(TLS{CertFile: "../testdata/tls/client.pem", KeyFile: "../testdata/tls/client.key"})
+		expect.Contains(t, err.Error(), "certificate")
+	})
+
+	t.Run("ErrorWhenServerNameDoesNotMatch", func(t *testing.T) {
+		err := probe(TLS{
+			CertFile:   "../testdata/tls/client.pem",
+			KeyFile:    "../testdata/tls/client.key",
+			CAFile:     caFile,
+			ServerName: "orders.svc",
+		})
+		expect.Contains(t, err.Error(), "orders.svc")
+	})
+
+	t.Run("SkipsVerification", func(t *testing.T) {
+		err := probe(TLS{
+			CertFile:           "../testdata/tls/client.pem",
+			KeyFile:            "../testdata/tls/client.key",
+			InsecureSkipVerify: true,
+		})
+		expect.NoError(t, err)
+	})
+}
+
+func TestTLSVersion(t *testing.T) {
+	var v TLSVersion
+	expect.NoError(t, v.UnmarshalText([]byte("1.3")))
+	expect.Equal(t, v.Version, uint16(tls.VersionTLS13))
+
+	err := v.UnmarshalText([]byte("1.4"))
+	expect.Contains(t, err.Error(), "Invalid TLS version")
+}
@@ -0,0 +1,119 @@
+package sermonreport
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// FoldDependencies sets the root cause of every service that's down because
+// a service it depends on is down, so only the root cause is alerted on.
+func (r *Report) FoldDependencies() {
+	byName := r.byName()
+	for _, service := range r.Services {
+		if service.Down() {
+			service.RootCause = rootCause(service, byName)
+		}
+	}
+}
+
+// rootCause returns the name of the deepest down dependency of a service, or
+// an empty string if all of its dependencies are up. Dependencies that are
+// not in the report are ignored.
+func rootCause(service *sermoncore.ServiceStatus, byName map[string]*sermoncore.ServiceStatus) string {
+	for _, name := range service.DependsOn {
+		dep, ok := byName[name]
+		if !ok || !dep.Down() {
+			continue
+		}
+		if root := rootCause(dep, byName); root != "" {
+			return root
+		}
+		return dep.Name
+	}
+	return ""
+}
+
+// byName returns the services in the Report by name. Services checked over
+// both IP versions are also listed by the name in the config, as the one
+// that's down if any, so depending on them means depending on both.
+func (r *Report) byName() map[string]*sermoncore.ServiceStatus {
+	byName := make(map[string]*sermoncore.ServiceStatus, len(r.Services))
+	for _, service := range r.Services {
+		byName[service.Name] = service
+	}
+	for _, service := range r.sorted() {
+		base := service.BaseName()
+		if base == service.Name {
+			continue
+		}
+		if other, ok := byName[base]; !ok || (!other.Down() && service.Down()) {
+			byName[base] = service
+		}
+	}
+	return byName
+}
+
+// affected returns the names of the services failing because of the given
+// one, sorted.
+func (r *Report) affected(root string) []string {
+	var names []string
+	for _, service := range r.Services {
+		if service.RootCause == root {
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeDependencies writes the dependency tree of the services in the Report,
+// each service followed by the ones depending on it. Services with no
+// dependencies and no dependents are left out.
+func (r *Report) writeDependencies(sb *strings.Builder) {
+	services := r.sorted()
+	dependents := map[string][]*sermoncore.ServiceStatus{}
+	byName := r.byName()
+	for _, service := range services {
+		for _, dep := range service.DependsOn {
+			if _, ok := byName[dep]; ok {
+				dependents[dep] = append(dependents[dep], service)
+			}
+		}
+	}
+	if len(dependents) == 0 {
+		return
+	}
+
+	sb.WriteString("\n[dependencies]\n")
+	for _, service := range services {
+		isRoot := true
+		for _, dep := range service.DependsOn {
+			if _, ok := byName[dep]; ok {
+				isRoot = false
+			}
+		}
+		if isRoot && len(dependents[service.BaseName()]) > 0 {
+			writeTree(sb, service, dependents, 0)
+		}
+	}
+}
+
+// writeTree writes a service and, indented, the ones depending on it.
+func writeTree(sb *strings.Builder, service *sermoncore.ServiceStatus, dependents map[string][]*sermoncore.ServiceStatus, depth int) {
+	status := "OK"
+	if service.Down() {
+		status = "ERROR"
+	}
+	sb.WriteString(fmt.Sprintf("%s%s -> %s", strings.Repeat("  ", depth), service.Name, status))
+	if service.RootCause != "" {
+		sb.WriteString(fmt.Sprintf(" (caused by %s)", service.RootCause))
+	}
+	sb.WriteString("\n")
+
+	for _, dependent := range dependents[service.BaseName()] {
+		writeTree(sb, dependent, dependents, depth+1)
+	}
+}
@@ -0,0 +1,88 @@
+package sermonreport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestFoldDependencies(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "vpn-gateway", Healthy: false, Err: errors.New("timeout")})
+	report.Add(&sermoncore.ServiceStatus{Name: "core-db", Healthy: false, Err: errors.New("timeout"), DependsOn: []string{"vpn-gateway"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "api", Healthy: false, Err: errors.New("timeout"), DependsOn: []string{"core-db"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "web", Healthy: true, DependsOn: []string{"api"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "search", Healthy: false, Err: errors.New("500"), DependsOn: []string{"missing"}})
+	report.FoldDependencies()
+
+	t.Run("SetsDeepestRootCause", func(t *testing.T) {
+		byName := report.byName()
+		expect.Equal(t, byName["vpn-gateway"].RootCause, "")
+		expect.Equal(t, byName["core-db"].RootCause, "vpn-gateway")
+		expect.Equal(t, byName["api"].RootCause, "vpn-gateway")
+		expect.Equal(t, byName["web"].RootCause, "")
+		expect.Equal(t, byName["search"].RootCause, "")
+	})
+
+	t.Run("OnlyAlertsOnRootCause", func(t *testing.T) {
+		byName := report.byName()
+		expect.Equal(t, byName["vpn-gateway"].Alerting(), true)
+		expect.Equal(t, byName["core-db"].Alerting(), false)
+		expect.Equal(t, byName["api"].Alerting(), false)
+		expect.Equal(t, byName["search"].Alerting(), true)
+	})
+
+	t.Run("FoldsFailuresIntoRootCause", func(t *testing.T) {
+		var buf bytes.Buffer
+		report.Log(&buf)
+		reportStr := buf.String()
+
+		expect.Contains(t, reportStr, "GET vpn-gateway -> ERROR: timeout\n    Also failing because of it: api, core-db\n")
+		expect.Equal(t, strings.Contains(reportStr, "GET api"), false)
+		expect.Equal(t, strings.Contains(reportStr, "GET core-db"), false)
+		expect.Contains(t, reportStr, "GET search -> ERROR: 500\n")
+	})
+
+	t.Run("PrintsDependencyTree", func(t *testing.T) {
+		var buf bytes.Buffer
+		report.Log(&buf)
+		expect.Contains(t, buf.String(), "\n[dependencies]\n"+
+			"vpn-gateway -> ERROR\n"+
+			"  core-db -> ERROR (caused by vpn-gateway)\n"+
+			"    api -> ERROR (caused by vpn-gateway)\n"+
+			"      web -> OK\n")
+	})
+}
+
+func TestFoldDependenciesOverIPVersions(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "db (IPv4)", ConfigName: "db", Healthy: true})
+	report.Add(&sermoncore.ServiceStatus{Name: "db (IPv6)", ConfigName: "db", Healthy: false, Err: errors.New("timeout")})
+	report.Add(&sermoncore.ServiceStatus{Name: "api", Healthy: false, Err: errors.New("500"), DependsOn: []string{"db"}})
+
+	report.FoldDependencies()
+	expect.Equal(t, report.Services[2].RootCause, "db (IPv6)")
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "db (IPv6) -> ERROR\n  api -> ERROR (caused by db (IPv6))\n")
+}
+
+func TestUnfoldMissingRoots(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "db", Healthy: false, Err: errors.New("timeout"), Tags: []string{"dba"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "api", Healthy: false, Err: errors.New("500"), DependsOn: []string{"db"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "worker", Healthy: false, Err: errors.New("500"), DependsOn: []string{"db"}, Tags: []string{"dba"}})
+	report.FoldDependencies()
+
+	dba := report.Filter(func(ss *sermoncore.ServiceStatus) bool { return ss.HasTag("dba") }).unfoldMissingRoots()
+	expect.Equal(t, dba.Services[1].Alerting(), false)
+
+	rest := report.Filter(func(ss *sermoncore.ServiceStatus) bool { return !ss.HasTag("dba") }).unfoldMissingRoots()
+	expect.Equal(t, rest.Services[0].Alerting(), true)
+	expect.Equal(t, report.Services[1].RootCause, "db")
+}
@@ -0,0 +1,179 @@
+package sermonreport
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"text/template"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/mailer"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+//go:embed digest.tmpl
+var digestTpl string
+
+//go:embed digest.html.tmpl
+var digestHTMLTpl string
+
+// Digest summarizes the history of every service over a period.
+type Digest struct {
+	From     time.Time
+	To       time.Time
+	Services []*sermonstate.Stats
+	// Incidents is the number of incidents of all services.
+	Incidents int
+	// MTTR is the mean time to recovery of all the incidents that were
+	// resolved.
+	MTTR time.Duration
+	// Slowest are the services with the highest average check duration.
+	Slowest []*sermonstate.Stats
+	// ExpiringCerts are the services with certificates that expire soon,
+	// the ones expiring first come first.
+	ExpiringCerts []*sermonstate.Stats
+}
+
+// NewDigest summarizes the records of the [from, to) period, as configured in
+// the digest settings.
+func NewDigest(records []sermonstate.Record, from time.Time, to time.Time, settings sermonconfig.Digest) *Digest {
+	d := &Digest{
+		From:     from,
+		To:       to,
+		Services: sermonstate.Summarize(records),
+	}
+
+	var totalRecovery time.Duration
+	var recovered int
+	for _, stats := range d.Services {
+		d.Incidents += stats.Incidents
+		// Stats only keep the mean, weight it by the resolved incidents.
+		totalRecovery += stats.MTTR * time.Duration(stats.Recovered)
+		recovered += stats.Recovered
+
+		if !stats.CertExpiry.IsZero() && stats.CertExpiry.Before(to.Add(settings.CertExpiry.Duration)) {
+			d.ExpiringCerts = append(d.ExpiringCerts, stats)
+		}
+	}
+	if recovered > 0 {
+		d.MTTR = totalRecovery / time.Duration(recovered)
+	}
+
+	sort.Slice(d.ExpiringCerts, func(i, j int) bool {
+		return d.ExpiringCerts[i].CertExpiry.Before(d.ExpiringCerts[j].CertExpiry)
+	})
+
+	d.Slowest = make([]*sermonstate.Stats, len(d.Services))
+	copy(d.Slowest, d.Services)
+	sort.SliceStable(d.Slowest, func(i, j int) bool {
+		return d.Slowest[i].AvgDuration > d.Slowest[j].AvgDuration
+	})
+	if len(d.Slowest) > settings.Slowest {
+		d.Slowest = d.Slowest[:settings.Slowest]
+	}
+
+	return d
+}
+
+// Log prints the Digest to the given io.Writer.
+func (d *Digest) Log(w io.Writer) error {
+	return template.Must(template.New("digest").Parse(digestTpl)).Execute(w, d)
+}
+
+// Email sends the Digest via email to the recipients in the digest settings
+// or, if there are none, to the default recipients.
+func (d *Digest) Email(config *sermonconfig.Config) error {
+	rcpt := config.Digest.Recipients
+	if rcpt.Empty() {
+		rcpt = config.DefaultRecipients()
+	}
+
+	var text bytes.Buffer
+	err := d.Log(&text)
+	if err != nil {
+		return err
+	}
+
+	var html bytes.Buffer
+	err = htmltemplate.Must(htmltemplate.New("digest.html").Parse(digestHTMLTpl)).Execute(&html, d)
+	if err != nil {
+		return err
+	}
+
+	return sendMessage(config, rcpt, &mailer.Message{
+		Subject: fmt.Sprintf("Sermon digest %s - %s", d.From.Format(dateLayout), d.To.Format(dateLayout)),
+		Text:    text.String(),
+		HTML:    html.String(),
+	})
+}
+
+// Post posts the Digest as JSON to the webhook in the digest settings.
+func (d *Digest) Post(config *sermonconfig.Config) error {
+	return postJSON(newWebhookClient(), *config.Digest.Webhook, d.payload())
+}
+
+// payload is the JSON representation of the Digest.
+func (d *Digest) payload() interface{} {
+	type service struct {
+		Name          string     `json:"name"`
+		Uptime        float64    `json:"uptime"`
+		Checks        int        `json:"checks"`
+		Failures      int        `json:"failures"`
+		Incidents     int        `json:"incidents"`
+		MTTRMs        int64      `json:"mttr_ms"`
+		AvgDurationMs int64      `json:"avg_duration_ms"`
+		CertExpiry    *time.Time `json:"cert_expiry,omitempty"`
+	}
+
+	toService := func(s *sermonstate.Stats) service {
+		svc := service{
+			Name:          s.Service,
+			Uptime:        s.Uptime(),
+			Checks:        s.Checks,
+			Failures:      s.Failures,
+			Incidents:     s.Incidents,
+			MTTRMs:        s.MTTR.Milliseconds(),
+			AvgDurationMs: s.AvgDuration.Milliseconds(),
+		}
+		if !s.CertExpiry.IsZero() {
+			expiry := s.CertExpiry
+			svc.CertExpiry = &expiry
+		}
+		return svc
+	}
+
+	names := func(stats []*sermonstate.Stats) []string {
+		n := make([]string, 0, len(stats))
+		for _, s := range stats {
+			n = append(n, s.Service)
+		}
+		return n
+	}
+
+	services := make([]service, 0, len(d.Services))
+	for _, s := range d.Services {
+		services = append(services, toService(s))
+	}
+
+	return struct {
+		From          time.Time `json:"from"`
+		To            time.Time `json:"to"`
+		Incidents     int       `json:"incidents"`
+		MTTRMs        int64     `json:"mttr_ms"`
+		Services      []service `json:"services"`
+		Slowest       []string  `json:"slowest"`
+		ExpiringCerts []string  `json:"expiring_certs"`
+	}{
+		From:          d.From,
+		To:            d.To,
+		Incidents:     d.Incidents,
+		MTTRMs:        d.MTTR.Milliseconds(),
+		Services:      services,
+		Slowest:       names(d.Slowest),
+		ExpiringCerts: names(d.ExpiringCerts),
+	}
+}
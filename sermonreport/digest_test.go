@@ -0,0 +1,82 @@
+package sermonreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+func TestDigest(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(7 * 24 * time.Hour)
+	soon := to.Add(10 * 24 * time.Hour)
+	later := to.Add(90 * 24 * time.Hour)
+	at := func(minutes int) time.Time {
+		return from.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	records := []sermonstate.Record{
+		{Time: at(0), Service: "fast.test", Healthy: true, DurationMs: 10, CertExpiry: &later},
+		{Time: at(0), Service: "slow.test", Healthy: true, DurationMs: 900, CertExpiry: &soon},
+		{Time: at(0), Service: "flaky.test", Healthy: false, DurationMs: 100},
+		{Time: at(10), Service: "flaky.test", Healthy: true, DurationMs: 100},
+		{Time: at(20), Service: "flaky.test", Healthy: false, DurationMs: 100},
+		{Time: at(50), Service: "flaky.test", Healthy: true, DurationMs: 100},
+	}
+
+	digest := NewDigest(records, from, to, sermonconfig.Digest{
+		Slowest:    2,
+		CertExpiry: sermonconfig.Duration{Duration: 30 * 24 * time.Hour},
+	})
+
+	t.Run("SummarizesIncidents", func(t *testing.T) {
+		expect.Equal(t, len(digest.Services), 3)
+		expect.Equal(t, digest.Incidents, 2)
+		expect.Equal(t, digest.MTTR, 20*time.Minute)
+	})
+
+	t.Run("ListsSlowestServices", func(t *testing.T) {
+		expect.Equal(t, len(digest.Slowest), 2)
+		expect.Equal(t, digest.Slowest[0].Service, "slow.test")
+		expect.Equal(t, digest.Slowest[1].Service, "flaky.test")
+	})
+
+	t.Run("ListsExpiringCerts", func(t *testing.T) {
+		expect.Equal(t, len(digest.ExpiringCerts), 1)
+		expect.Equal(t, digest.ExpiringCerts[0].Service, "slow.test")
+	})
+
+	t.Run("PrintsDigestToGivenWriter", func(t *testing.T) {
+		var buf bytes.Buffer
+		expect.NoError(t, digest.Log(&buf))
+		out := buf.String()
+		expect.Contains(t, out, "INCIDENTS: 2")
+		expect.Contains(t, out, "MTTR: 20m0s")
+		expect.Contains(t, out, "50.000% flaky.test (2/4 failed, 2 incidents, MTTR 20m0s)")
+		expect.Contains(t, out, "900ms slow.test")
+		expect.Contains(t, out, soon.Format("2006-01-02")+" slow.test")
+	})
+
+	t.Run("EncodesPayloadAsJSON", func(t *testing.T) {
+		b, err := json.Marshal(digest.payload())
+		expect.NoError(t, err)
+		expect.Contains(t, string(b), `"incidents":2`)
+		expect.Contains(t, string(b), `"mttr_ms":1200000`)
+		expect.Contains(t, string(b), `"expiring_certs":["slow.test"]`)
+	})
+}
+
+func TestDigestWithoutHistory(t *testing.T) {
+	now := time.Now()
+	digest := NewDigest(nil, now.Add(-time.Hour), now, sermonconfig.Digest{Slowest: 5})
+
+	var buf bytes.Buffer
+	expect.NoError(t, digest.Log(&buf))
+	expect.Contains(t, buf.String(), "No checks in this period.")
+	expect.Equal(t, len(digest.Slowest), 0)
+}
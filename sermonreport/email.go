@@ -0,0 +1,403 @@
+package sermonreport
+
+import (
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/mailer"
+	"gitlab.com/germandv/sermon/internal/secret"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+const (
+	DefaultHost = "smtp.gmail.com"
+	DefaultPort = 587
+)
+
+const (
+	emailSubject = "Sermon report"
+	dateLayout   = "2006-01-02"
+)
+
+// getEmailConfig creates a mailer.Config with the given SMTP settings or, if
+// there are none, with information from env vars.
+func getEmailConfig(smtp *sermonconfig.SMTP) (*mailer.Config, error) {
+	if smtp != nil {
+		return getSMTPConfig(smtp), nil
+	}
+
+	username, okU := os.LookupEnv("EMAIL_USERNAME")
+	password, okP := os.LookupEnv("EMAIL_PASSWORD")
+	if !okU || !okP {
+		return nil, errors.New("The following env vars must be present to be able to email the report: EMAIL_USERNAME, EMAIL_PASSWORD")
+	}
+
+	host := os.Getenv("EMAIL_HOST")
+	if host == "" {
+		host = DefaultHost
+	}
+
+	var port int
+	portStr := os.Getenv("EMAIL_PORT")
+	if portStr != "" {
+		var err error
+		port, err = strconv.Atoi(portStr)
+		if err != nil {
+			return nil, errors.New("EMAIL_PORT must be a number")
+		}
+	} else {
+		port = DefaultPort
+	}
+
+	return &mailer.Config{
+		Username: username,
+		Password: secret.New(password),
+		Host:     host,
+		Port:     port,
+		TLSMode:  mailer.TLSStartTLS,
+	}, nil
+}
+
+// getSMTPConfig creates a mailer.Config from the SMTP settings in the config.
+// The TLS mode defaults to STARTTLS, and the port to the usual one for the
+// TLS mode.
+func getSMTPConfig(smtp *sermonconfig.SMTP) *mailer.Config {
+	mode := mailer.TLSMode(smtp.TLSMode.Mode)
+	if mode == "" {
+		mode = mailer.TLSStartTLS
+	}
+
+	port := smtp.Port
+	if port == 0 {
+		switch mode {
+		case mailer.TLSImplicit:
+			port = 465
+		case mailer.TLSNone:
+			port = 25
+		default:
+			port = DefaultPort
+		}
+	}
+
+	return &mailer.Config{
+		Username:           smtp.Username,
+		Password:           smtp.Password.Value,
+		Host:               smtp.Host,
+		Port:               port,
+		From:               smtp.From.Address,
+		TLSMode:            mode,
+		CAFile:             smtp.CAFile,
+		InsecureSkipVerify: smtp.InsecureSkipVerify,
+	}
+}
+
+//go:embed email.tmpl
+var emailTpl string
+
+//go:embed email.html.tmpl
+var emailHTMLTpl string
+
+// TemplateData is the data available to the email templates.
+type TemplateData struct {
+	Report *Report
+	// Services are all the services in the Report, sorted by name.
+	Services []*sermoncore.ServiceStatus
+	// Unhealthy are the unhealthy services in the Report, sorted by name.
+	Unhealthy  []*sermoncore.ServiceStatus
+	Successful int
+	Failed     int
+	Total      int
+	Date       time.Time
+	// Body is the Report as printed by Log.
+	Body string
+}
+
+// newTemplateData gathers the data of the Report available to templates.
+func newTemplateData(r *Report) *TemplateData {
+	var body bytes.Buffer
+	r.Log(&body)
+
+	data := &TemplateData{
+		Report:     r,
+		Services:   r.sorted(),
+		Successful: r.Successful,
+		Failed:     r.Failed,
+		Total:      r.Successful + r.Failed,
+		Date:       time.Now().UTC(),
+		Body:       body.String(),
+	}
+	for _, service := range data.Services {
+		if !service.Healthy {
+			data.Unhealthy = append(data.Unhealthy, service)
+		}
+	}
+
+	return data
+}
+
+// renderEmail renders the subject, plain text and HTML versions of an email
+// about the Report, with the templates in the settings or the default ones.
+func renderEmail(r *Report, settings sermonconfig.EmailNotifications) (string, string, string, error) {
+	data := newTemplateData(r)
+
+	subjectTpl := emailSubject
+	if settings.Subject.Text != "" {
+		subjectTpl = settings.Subject.Text
+	}
+	textTpl := emailTpl
+	if settings.TextTemplate.Content != "" {
+		textTpl = settings.TextTemplate.Content
+	}
+	htmlTpl := emailHTMLTpl
+	if settings.HTMLTemplate.Content != "" {
+		htmlTpl = settings.HTMLTemplate.Content
+	}
+
+	var subject bytes.Buffer
+	tpl, err := template.New("subject").Parse(subjectTpl)
+	if err == nil {
+		err = tpl.Execute(&subject, data)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var text bytes.Buffer
+	tpl, err = template.New("text").Parse(textTpl)
+	if err == nil {
+		err = tpl.Execute(&text, data)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	var html bytes.Buffer
+	htmlTemplate, err := htmltemplate.New("html").Parse(htmlTpl)
+	if err == nil {
+		err = htmlTemplate.Execute(&html, data)
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	return strings.TrimSpace(subject.String()), text.String(), html.String(), nil
+}
+
+// getEmail renders the Report as a MIME email with a plain text and an HTML
+// version, and the full Report attached if the settings ask for it.
+func getEmail(from string, rcpt sermonconfig.Recipients, r *Report, settings sermonconfig.EmailNotifications) (*mailer.Mail, error) {
+	subject, text, html, err := renderEmail(r, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	to := addresses(rcpt.To)
+	cc := addresses(rcpt.CC)
+	thread := threadID(r, mailer.Domain(from))
+
+	msg := &mailer.Message{
+		From:       from,
+		To:         to,
+		Cc:         cc,
+		Subject:    subject,
+		InReplyTo:  thread,
+		References: []string{thread},
+		Text:       text,
+		HTML:       html,
+	}
+
+	if format := settings.Attachment.Format; format != "" {
+		a, err := getAttachment(r, format)
+		if err != nil {
+			return nil, err
+		}
+		msg.Attachments = append(msg.Attachments, a)
+	}
+
+	content, err := msg.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mailer.Mail{
+		To:   to,
+		Cc:   cc,
+		Bcc:  addresses(rcpt.BCC),
+		Body: content,
+	}, nil
+}
+
+// getAttachment exports the Report in the given format, json or csv.
+func getAttachment(r *Report, format string) (mailer.Attachment, error) {
+	var buf bytes.Buffer
+	a := mailer.Attachment{Filename: "sermon-report." + format}
+
+	var err error
+	switch format {
+	case "json":
+		a.ContentType = "application/json"
+		err = r.JSON(&buf)
+	case "csv":
+		a.ContentType = "text/csv"
+		err = r.CSV(&buf)
+	default:
+		err = fmt.Errorf("Invalid attachment format: %s", format)
+	}
+
+	a.Data = buf.Bytes()
+	return a, err
+}
+
+// threadID identifies the incident a Report is about by the set of unhealthy
+// services, so emails about the same services are threaded together.
+func threadID(r *Report, domain string) string {
+	var names []string
+	for _, service := range r.Services {
+		if !service.Healthy {
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+
+	sum := sha1.Sum([]byte(strings.Join(names, "\n")))
+	return fmt.Sprintf("<sermon.%s@%s>", hex.EncodeToString(sum[:8]), domain)
+}
+
+// addresses returns the address of every email.
+func addresses(emails []sermonconfig.Email) []string {
+	addrs := make([]string, 0, len(emails))
+	for _, e := range emails {
+		addrs = append(addrs, e.Address)
+	}
+	return addrs
+}
+
+// Email sends Report via email, using the SMTP settings in the config or, if
+// there are none, the ones in the `EMAIL_*` env vars.
+func (r *Report) Email(config *sermonconfig.Config, rcpt sermonconfig.Recipients) error {
+	cfg, err := getEmailConfig(config.SMTP)
+	if err != nil {
+		return err
+	}
+
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+
+	email, err := getEmail(from, rcpt, r, config.Notifications.Email)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(cfg, email)
+}
+
+// EmailFail sends the Report via email only if there are services to alert
+// about: unhealthy ones or, if their state is tracked, DOWN ones.
+func (r *Report) EmailFail(config *sermonconfig.Config, rcpt sermonconfig.Recipients) error {
+	someAlerting := some(r.Services, func(ss *sermoncore.ServiceStatus) bool {
+		return ss.Alerting()
+	})
+
+	if someAlerting {
+		return r.Email(config, rcpt)
+	}
+
+	return nil
+}
+
+// EmailRoutes splits the Report according to the routes in the config, and
+// emails every part with unhealthy services to the recipients of its route.
+// Services not matched by any route are emailed to the default recipients.
+// Services failing because of a dependency are only folded into it if it's
+// in the same part, so they're alerted on if their recipients wouldn't hear
+// about it otherwise.
+func (r *Report) EmailRoutes(config *sermonconfig.Config) error {
+	var errs []string
+
+	for _, route := range config.Routes {
+		rt := route
+		part := r.Filter(rt.Match).unfoldMissingRoots()
+		if err := part.EmailFail(config, rt.Recipients); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	rest := r.Filter(func(ss *sermoncore.ServiceStatus) bool {
+		return !some(config.Routes, func(rt sermonconfig.Route) bool {
+			return rt.Match(ss)
+		})
+	}).unfoldMissingRoots()
+	if rcpt := config.DefaultRecipients(); !rcpt.Empty() {
+		if err := rest.EmailFail(config, rcpt); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Unable to email report: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// unfoldMissingRoots returns the Report with the root cause cleared from the
+// services whose root cause is not in it. Those are copies, so the Report it
+// was filtered from is left untouched.
+func (r *Report) unfoldMissingRoots() *Report {
+	names := make(map[string]bool, len(r.Services))
+	for _, service := range r.Services {
+		names[service.Name] = true
+	}
+
+	unfolded := &Report{}
+	for _, service := range r.Services {
+		if service.RootCause != "" && !names[service.RootCause] {
+			cp := *service
+			cp.RootCause = ""
+			service = &cp
+		}
+		unfolded.Add(service)
+	}
+	return unfolded
+}
+
+// sendMessage sends a message, other than the report, to the given recipients
+// from the configured email server.
+func sendMessage(config *sermonconfig.Config, rcpt sermonconfig.Recipients, msg *mailer.Message) error {
+	cfg, err := getEmailConfig(config.SMTP)
+	if err != nil {
+		return err
+	}
+
+	msg.From = cfg.From
+	if msg.From == "" {
+		msg.From = cfg.Username
+	}
+	msg.To = addresses(rcpt.To)
+	msg.Cc = addresses(rcpt.CC)
+
+	content, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	return mailer.Send(cfg, &mailer.Mail{
+		To:   msg.To,
+		Cc:   msg.Cc,
+		Bcc:  addresses(rcpt.BCC),
+		Body: content,
+	})
+}
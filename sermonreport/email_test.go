@@ -0,0 +1,184 @@
+package sermonreport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/mailer"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestGetEmail(t *testing.T) {
+	t.Run("MissingRequiredEnvVars", func(t *testing.T) {
+		config, err := getEmailConfig(nil)
+		expect.Nil(t, config)
+		expect.Contains(t, err.Error(), "env vars must be present")
+	})
+
+	t.Run("UsesEnvVarsToPopulateConfig", func(t *testing.T) {
+		username := "some@email.io"
+		password := "abc1234"
+		host := "smtp.fastmail.com"
+		port := 486
+		os.Setenv("EMAIL_USERNAME", username)
+		os.Setenv("EMAIL_PASSWORD", password)
+		os.Setenv("EMAIL_HOST", host)
+		os.Setenv("EMAIL_PORT", fmt.Sprint(port))
+		config, err := getEmailConfig(nil)
+		expect.NoError(t, err)
+		expect.Equal(t, config.Username, username)
+		expect.Equal(t, config.Password.Expose(), password)
+		expect.Equal(t, config.Host, host)
+		expect.Equal(t, config.Port, 486)
+		os.Unsetenv("EMAIL_USERNAME")
+		os.Unsetenv("EMAIL_PASSWORD")
+		os.Unsetenv("EMAIL_HOST")
+		os.Unsetenv("EMAIL_PORT")
+	})
+
+	t.Run("MissingOptionalEnvVarsReturnsDefaults", func(t *testing.T) {
+		os.Setenv("EMAIL_USERNAME", "some@email.io")
+		os.Setenv("EMAIL_PASSWORD", "abc1234")
+		config, err := getEmailConfig(nil)
+		expect.NoError(t, err)
+		expect.Equal(t, config.Host, DefaultHost)
+		expect.Equal(t, config.Port, DefaultPort)
+		os.Unsetenv("EMAIL_USERNAME")
+		os.Unsetenv("EMAIL_PASSWORD")
+	})
+}
+
+func TestGetSMTPConfig(t *testing.T) {
+	t.Run("DefaultsToStartTLS", func(t *testing.T) {
+		config, err := getEmailConfig(&sermonconfig.SMTP{Host: "smtp.me.io", Username: "some@email.io"})
+		expect.NoError(t, err)
+		expect.Equal(t, config.TLSMode, mailer.TLSStartTLS)
+		expect.Equal(t, config.Port, DefaultPort)
+	})
+
+	t.Run("DefaultsPortForTLSMode", func(t *testing.T) {
+		config, err := getEmailConfig(&sermonconfig.SMTP{
+			Host:    "smtp.me.io",
+			From:    sermonconfig.Email{Address: "sermon@me.io"},
+			TLSMode: sermonconfig.TLSMode{Mode: "implicit"},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, config.Port, 465)
+		expect.Equal(t, config.From, "sermon@me.io")
+	})
+
+	t.Run("KeepsExplicitPort", func(t *testing.T) {
+		config, err := getEmailConfig(&sermonconfig.SMTP{
+			Host:    "relay.internal",
+			Port:    2525,
+			TLSMode: sermonconfig.TLSMode{Mode: "none"},
+		})
+		expect.NoError(t, err)
+		expect.Equal(t, config.Port, 2525)
+		expect.Equal(t, config.TLSMode, mailer.TLSNone)
+	})
+}
+
+func TestGetEmailRecipients(t *testing.T) {
+	rcpt := sermonconfig.Recipients{
+		To:  []sermonconfig.Email{{Address: "team@me.io"}, {Address: "ops@me.io"}},
+		CC:  []sermonconfig.Email{{Address: "lead@me.io"}},
+		BCC: []sermonconfig.Email{{Address: "audit@me.io"}},
+	}
+
+	email, err := getEmail("sermon@me.io", rcpt, &Report{}, sermonconfig.EmailNotifications{})
+	expect.NoError(t, err)
+
+	body := string(email.Body)
+	expect.Contains(t, body, "To: team@me.io, ops@me.io\r\nCc: lead@me.io\r\n")
+	expect.Equal(t, strings.Contains(body, "audit@me.io"), false)
+	expect.Equal(t, len(email.Recipients()), 4)
+}
+
+func TestGetEmailMIME(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "good.test", Healthy: true, Severity: "critical"})
+	report.Add(&sermoncore.ServiceStatus{Name: "<bad>.test", Healthy: false, Err: errors.New("timeout"), Severity: "warning"})
+	rcpt := sermonconfig.Recipients{To: []sermonconfig.Email{{Address: "team@me.io"}}}
+
+	t.Run("HasStandardHeaders", func(t *testing.T) {
+		email, err := getEmail("sermon@me.io", rcpt, report, sermonconfig.EmailNotifications{})
+		expect.NoError(t, err)
+		body := string(email.Body)
+		expect.Contains(t, body, "From: sermon@me.io\r\n")
+		expect.Contains(t, body, "Subject: Sermon report\r\n")
+		expect.Contains(t, body, "\r\nDate: ")
+		expect.Contains(t, body, "\r\nMessage-ID: <")
+		expect.Contains(t, body, "\r\nMIME-Version: 1.0\r\n")
+		expect.Contains(t, body, "Content-Type: multipart/alternative;")
+		expect.Equal(t, strings.Contains(body, "multipart/mixed"), false)
+	})
+
+	t.Run("HasTextAndHTMLParts", func(t *testing.T) {
+		email, err := getEmail("sermon@me.io", rcpt, report, sermonconfig.EmailNotifications{})
+		expect.NoError(t, err)
+		body := string(email.Body)
+		expect.Contains(t, body, "Content-Type: text/plain; charset=utf-8")
+		expect.Contains(t, body, "Content-Type: text/html; charset=utf-8")
+		expect.Contains(t, body, "GET good.test -> OK")
+		expect.Contains(t, body, "&lt;bad&gt;.test")
+	})
+
+	t.Run("AttachesReport", func(t *testing.T) {
+		email, err := getEmail("sermon@me.io", rcpt, report, sermonconfig.EmailNotifications{
+			Attachment: sermonconfig.AttachmentFormat{Format: "csv"},
+		})
+		expect.NoError(t, err)
+		body := string(email.Body)
+		expect.Contains(t, body, "Content-Type: multipart/mixed;")
+		expect.Contains(t, body, "Content-Disposition: attachment; filename=sermon-report.csv")
+	})
+
+	t.Run("ThreadsEmailsAboutTheSameServices", func(t *testing.T) {
+		same := &Report{}
+		same.Add(&sermoncore.ServiceStatus{Name: "<bad>.test", Healthy: false, Err: errors.New("refused")})
+		other := &Report{}
+		other.Add(&sermoncore.ServiceStatus{Name: "good.test", Healthy: false, Err: errors.New("refused")})
+
+		thread := threadID(report, "me.io")
+		expect.Equal(t, threadID(same, "me.io"), thread)
+		expect.Equal(t, threadID(other, "me.io") == thread, false)
+
+		email, err := getEmail("sermon@me.io", rcpt, report, sermonconfig.EmailNotifications{})
+		expect.NoError(t, err)
+		expect.Contains(t, string(email.Body), "In-Reply-To: "+thread+"\r\n")
+		expect.Contains(t, string(email.Body), "References: "+thread+"\r\n")
+	})
+}
+
+func TestRenderEmailWithCustomTemplates(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "good.test", Healthy: true})
+	report.Add(&sermoncore.ServiceStatus{Name: "bad.test", Healthy: false, Err: errors.New("timeout"), Endpoint: "https://bad.test/health"})
+
+	settings := sermonconfig.EmailNotifications{
+		Subject:      sermonconfig.Template{Text: "[{{.Failed}}/{{.Total}} down] {{range .Unhealthy}}{{.Name}} {{end}}"},
+		TextTemplate: sermonconfig.TemplateFile{Path: "text.tmpl", Content: "{{range .Unhealthy}}{{.Name}} ({{.Endpoint}}): {{.Err}}{{end}}"},
+	}
+
+	subject, text, html, err := renderEmail(report, settings)
+	expect.NoError(t, err)
+	expect.Equal(t, subject, "[1/2 down] bad.test")
+	expect.Equal(t, text, "bad.test (https://bad.test/health): timeout")
+	expect.Contains(t, html, `<a href="https://bad.test/health">bad.test</a>`)
+}
+
+func TestRenderEmailDoesNotLinkInterpolatedEndpoints(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "api.test", Healthy: false, Endpoint: "https://api.test/health?token=${API_TOKEN}"})
+
+	_, _, html, err := renderEmail(report, sermonconfig.EmailNotifications{})
+	expect.NoError(t, err)
+	expect.Equal(t, strings.Contains(html, "API_TOKEN"), false)
+	expect.Contains(t, html, "<td>api.test</td>")
+}
@@ -0,0 +1,89 @@
+package sermonreport
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/mailer"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermoncore"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+// Escalate notifies a level of an escalation policy about an incident of the
+// given service, via its webhook and email recipients.
+func Escalate(config *sermonconfig.Config, service sermoncore.Service, incident *sermonstate.Incident, policy string, level int) error {
+	l := config.Escalations[policy].Levels[level]
+	var errs []string
+
+	if l.Webhook != nil {
+		err := postJSON(newWebhookClient(), *l.Webhook, escalationPayload(incident, service, policy, level))
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if !l.Empty() {
+		text := escalationText(incident, service, policy, level)
+		err := sendMessage(config, l.Recipients, &mailer.Message{
+			Subject: fmt.Sprintf("Sermon escalation: %s is down (incident %s)", incident.Service, incident.ID),
+			Text:    text,
+			HTML:    "<pre>" + html.EscapeString(text) + "</pre>",
+		})
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Unable to escalate incident %s: %s", incident.ID, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// escalationText describes the incident, and who and what can help with its
+// service, for a level of an escalation policy.
+func escalationText(incident *sermonstate.Incident, service sermoncore.Service, policy string, level int) string {
+	var sb bytes.Buffer
+	sb.WriteString(fmt.Sprintf("Incident %s: %s is down and hasn't been acknowledged.\n", incident.ID, incident.Service))
+	sb.WriteString(fmt.Sprintf("Opened: %s\n", incident.Opened.Format(time.RFC1123)))
+	sb.WriteString(fmt.Sprintf("Failed checks: %d\n", incident.Attempts))
+	sb.WriteString(fmt.Sprintf("Escalation: %s, level %d\n", policy, level+1))
+	if n := len(incident.Errors); n > 0 {
+		sb.WriteString(fmt.Sprintf("Last error: %s\n", incident.Errors[n-1].Error))
+	}
+	if service.Owner != "" {
+		sb.WriteString(fmt.Sprintf("Owner: %s\n", service.Owner))
+	}
+	if service.RunbookURL != "" {
+		sb.WriteString(fmt.Sprintf("Runbook: %s\n", service.RunbookURL))
+	}
+	if service.DashboardURL != "" {
+		sb.WriteString(fmt.Sprintf("Dashboard: %s\n", service.DashboardURL))
+	}
+	return sb.String()
+}
+
+// escalationPayload is the JSON posted to the webhook of an escalation level.
+func escalationPayload(incident *sermonstate.Incident, service sermoncore.Service, policy string, level int) interface{} {
+	return struct {
+		Text         string                `json:"text"`
+		Escalation   string                `json:"escalation"`
+		Level        int                   `json:"level"`
+		Owner        string                `json:"owner,omitempty"`
+		RunbookURL   string                `json:"runbook_url,omitempty"`
+		DashboardURL string                `json:"dashboard_url,omitempty"`
+		Incident     *sermonstate.Incident `json:"incident"`
+	}{
+		Text:         escalationText(incident, service, policy, level),
+		Escalation:   policy,
+		Level:        level + 1,
+		Owner:        service.Owner,
+		RunbookURL:   service.RunbookURL,
+		DashboardURL: service.DashboardURL,
+		Incident:     incident,
+	}
+}
@@ -0,0 +1,52 @@
+package sermonreport
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+func TestEscalationPayload(t *testing.T) {
+	incident := &sermonstate.Incident{
+		ID:       "abc123",
+		Service:  "api.test",
+		Opened:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Attempts: 3,
+	}
+	service := sermoncore.Service{
+		Owner:        "backend-team",
+		RunbookURL:   "https://wiki.test/runbooks/api",
+		DashboardURL: "https://grafana.test/d/api",
+	}
+
+	content, err := json.Marshal(escalationPayload(incident, service, "backend", 1))
+	expect.NoError(t, err)
+
+	var payload struct {
+		Text         string `json:"text"`
+		Level        int    `json:"level"`
+		Owner        string `json:"owner"`
+		RunbookURL   string `json:"runbook_url"`
+		DashboardURL string `json:"dashboard_url"`
+	}
+	expect.NoError(t, json.Unmarshal(content, &payload))
+	expect.Equal(t, payload.Level, 2)
+	expect.Equal(t, payload.Owner, "backend-team")
+	expect.Equal(t, payload.RunbookURL, "https://wiki.test/runbooks/api")
+	expect.Equal(t, payload.DashboardURL, "https://grafana.test/d/api")
+	expect.Contains(t, payload.Text, "Escalation: backend, level 2")
+	expect.Contains(t, payload.Text, "Owner: backend-team")
+	expect.Contains(t, payload.Text, "Runbook: https://wiki.test/runbooks/api")
+	expect.Contains(t, payload.Text, "Dashboard: https://grafana.test/d/api")
+
+	content, err = json.Marshal(escalationPayload(incident, sermoncore.Service{}, "backend", 0))
+	expect.NoError(t, err)
+	var fields map[string]interface{}
+	expect.NoError(t, json.Unmarshal(content, &fields))
+	_, ok := fields["owner"]
+	expect.Equal(t, ok, false)
+}
@@ -0,0 +1,70 @@
+package sermonreport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+// JSON writes the Report to the given io.Writer as JSON.
+func (r *Report) JSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Date       time.Time                   `json:"date"`
+		Successful int                         `json:"successful"`
+		Failed     int                         `json:"failed"`
+		Total      int                         `json:"total"`
+		Services   []*sermoncore.ServiceStatus `json:"services"`
+	}{
+		Date:       time.Now().UTC(),
+		Successful: r.Successful,
+		Failed:     r.Failed,
+		Total:      r.Successful + r.Failed,
+		Services:   r.sorted(),
+	})
+}
+
+// CSV writes the Report to the given io.Writer as CSV, one service per row.
+func (r *Report) CSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{
+		"name", "healthy", "severity", "group", "tags", "error",
+		"description", "owner", "runbook_url", "dashboard_url",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, service := range r.sorted() {
+		var errMsg string
+		if service.Err != nil {
+			errMsg = service.Err.Error()
+		}
+
+		err = cw.Write([]string{
+			service.Name,
+			strconv.FormatBool(service.Healthy),
+			service.Severity,
+			service.Group,
+			strings.Join(service.Tags, ";"),
+			errMsg,
+			service.Description,
+			service.Owner,
+			service.RunbookURL,
+			service.DashboardURL,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
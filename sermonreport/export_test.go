@@ -0,0 +1,54 @@
+package sermonreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestExport(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "good.test", Healthy: true, Severity: "critical", Tags: []string{"prod", "web"}})
+	report.Add(&sermoncore.ServiceStatus{
+		Name:       "bad.test",
+		Healthy:    false,
+		Err:        errors.New("timeout"),
+		Severity:   "warning",
+		Owner:      "payments",
+		RunbookURL: "https://wiki.test/bad",
+	})
+
+	t.Run("JSONIncludesCountsAndErrors", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := report.JSON(&buf)
+		expect.NoError(t, err)
+
+		var decoded struct {
+			Total    int
+			Services []struct {
+				Name       string
+				Error      string
+				RunbookURL string `json:"runbook_url"`
+			}
+		}
+		err = json.Unmarshal(buf.Bytes(), &decoded)
+		expect.NoError(t, err)
+		expect.Equal(t, decoded.Total, 2)
+		expect.Equal(t, decoded.Services[0].Name, "bad.test")
+		expect.Equal(t, decoded.Services[0].Error, "timeout")
+		expect.Equal(t, decoded.Services[0].RunbookURL, "https://wiki.test/bad")
+	})
+
+	t.Run("CSVHasOneRowPerService", func(t *testing.T) {
+		var buf bytes.Buffer
+		err := report.CSV(&buf)
+		expect.NoError(t, err)
+		expect.Equal(t, buf.String(), "name,healthy,severity,group,tags,error,description,owner,runbook_url,dashboard_url\n"+
+			"bad.test,false,warning,,,timeout,,payments,https://wiki.test/bad,\n"+
+			"good.test,true,critical,,prod;web,,,,,\n")
+	})
+}
@@ -0,0 +1,64 @@
+package sermonreport
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Metrics writes the Report to the given io.Writer in the Prometheus text
+// format.
+func (r *Report) Metrics(w io.Writer) error {
+	services := r.sorted()
+	var sb strings.Builder
+
+	sb.WriteString("# HELP sermon_up Whether the last check of the service passed.\n")
+	sb.WriteString("# TYPE sermon_up gauge\n")
+	for _, s := range services {
+		up := 0
+		if s.Healthy {
+			up = 1
+		}
+		sb.WriteString(fmt.Sprintf("sermon_up{service=%s} %d\n", label(s.Name), up))
+	}
+
+	sb.WriteString("# HELP sermon_check_duration_seconds How long the last check of the service took.\n")
+	sb.WriteString("# TYPE sermon_check_duration_seconds gauge\n")
+	for _, s := range services {
+		sb.WriteString(fmt.Sprintf("sermon_check_duration_seconds{service=%s} %s\n", label(s.Name), seconds(s.Duration.Seconds())))
+	}
+
+	sb.WriteString("# HELP sermon_check_phase_seconds How long each phase of the request of the last HTTP check took.\n")
+	sb.WriteString("# TYPE sermon_check_phase_seconds gauge\n")
+	for _, s := range services {
+		if s.Timing == nil {
+			continue
+		}
+		for _, p := range s.Timing.Phases() {
+			sb.WriteString(fmt.Sprintf("sermon_check_phase_seconds{service=%s,phase=%q} %s\n", label(s.Name), p.Name, seconds(p.Duration.Seconds())))
+		}
+	}
+
+	sb.WriteString("# HELP sermon_cert_expiry_timestamp_seconds When the TLS certificate of the service expires.\n")
+	sb.WriteString("# TYPE sermon_cert_expiry_timestamp_seconds gauge\n")
+	for _, s := range services {
+		if s.CertExpiry.IsZero() {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("sermon_cert_expiry_timestamp_seconds{service=%s} %d\n", label(s.Name), s.CertExpiry.Unix()))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// label quotes a label value, escaping backslashes, quotes and new lines.
+func label(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(value) + `"`
+}
+
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
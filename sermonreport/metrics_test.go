@@ -0,0 +1,42 @@
+package sermonreport
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestMetrics(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:       "api.test",
+		Healthy:    true,
+		Duration:   250 * time.Millisecond,
+		CertExpiry: time.Unix(1767225600, 0),
+		Timing:     &sermoncore.Timing{DNS: 5 * time.Millisecond, Total: 250 * time.Millisecond},
+	})
+	report.Add(&sermoncore.ServiceStatus{
+		Name:    `backups "nightly"`,
+		Healthy: false,
+		Err:     errors.New("No ping"),
+	})
+
+	var buf bytes.Buffer
+	err := report.Metrics(&buf)
+	expect.NoError(t, err)
+
+	metrics := buf.String()
+	expect.Contains(t, metrics, "# TYPE sermon_up gauge\n")
+	expect.Contains(t, metrics, "sermon_up{service=\"api.test\"} 1\n")
+	expect.Contains(t, metrics, "sermon_up{service=\"backups \\\"nightly\\\"\"} 0\n")
+	expect.Contains(t, metrics, "sermon_check_duration_seconds{service=\"api.test\"} 0.25\n")
+	expect.Contains(t, metrics, "sermon_check_phase_seconds{service=\"api.test\",phase=\"dns\"} 0.005\n")
+	expect.Contains(t, metrics, "sermon_check_phase_seconds{service=\"api.test\",phase=\"total\"} 0.25\n")
+	expect.Contains(t, metrics, "sermon_cert_expiry_timestamp_seconds{service=\"api.test\"} 1767225600\n")
+	expect.Equal(t, strings.Contains(metrics, "phase_seconds{service=\"backups"), false)
+}
@@ -1,28 +1,16 @@
 package sermonreport
 
 import (
-	"bytes"
-	_ "embed"
-	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
-	"gitlab.com/germandv/sermon/internal/mailer"
-	"gitlab.com/germandv/sermon/internal/secret"
 	"gitlab.com/germandv/sermon/sermoncore"
 )
 
-const (
-	DefaultHost = "smtp.gmail.com"
-	DefaultPort = 587
-)
-
 // Report consolidates information about health of all services.
 type Report struct {
 	Services   []*sermoncore.ServiceStatus
@@ -43,7 +31,10 @@ func (r *Report) Add(service *sermoncore.ServiceStatus) {
 	r.Services = append(r.Services, service)
 }
 
-// Log prints Report information to the given io.Writer.
+// Log prints Report information to the given io.Writer. Services with a group
+// or tags are listed in a section per group or tag. Services failing because
+// of a dependency are listed along with the root cause, followed by the
+// dependency tree.
 func (r *Report) Log(w io.Writer) {
 	sb := strings.Builder{}
 
@@ -52,106 +43,145 @@ func (r *Report) Log(w io.Writer) {
 	sb.WriteString(fmt.Sprintf("FAILED: %d\n", r.Failed))
 	sb.WriteString(fmt.Sprintf("TOTAL: %d\n", r.Successful+r.Failed))
 
-	for _, service := range r.Services {
-		if !service.Healthy {
-			sb.WriteString(fmt.Sprintf("GET %s -> ERROR: %s\n", service.Name, service.Err))
-		} else {
-			sb.WriteString(fmt.Sprintf("GET %s -> OK\n", service.Name))
-		}
+	ungrouped, sections := r.sections()
+	for _, service := range ungrouped {
+		r.writeService(&sb, service)
 	}
 
-	fmt.Fprint(w, sb.String())
-}
-
-// getEmailConfig creates a mailer.Config with information from env vars.
-func getEmailConfig() (*mailer.Config, error) {
-	username, okU := os.LookupEnv("EMAIL_USERNAME")
-	password, okP := os.LookupEnv("EMAIL_PASSWORD")
-	if !okU || !okP {
-		return nil, errors.New("The following env vars must be present to be able to email the report: EMAIL_USERNAME, EMAIL_PASSWORD")
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	host := os.Getenv("EMAIL_HOST")
-	if host == "" {
-		host = DefaultHost
+	for _, name := range names {
+		sb.WriteString(fmt.Sprintf("\n[%s]\n", name))
+		for _, service := range sections[name] {
+			r.writeService(&sb, service)
+		}
 	}
 
-	var port int
-	portStr := os.Getenv("EMAIL_PORT")
-	if portStr != "" {
-		var err error
-		port, err = strconv.Atoi(portStr)
-		if err != nil {
-			return nil, errors.New("EMAIL_PORT must be a number")
+	r.writeDependencies(&sb)
+	fmt.Fprint(w, sb.String())
+}
+
+// sections splits the services in the Report into the ones without a section
+// and the ones listed under each section, sorted by name.
+func (r *Report) sections() ([]*sermoncore.ServiceStatus, map[string][]*sermoncore.ServiceStatus) {
+	services := r.sorted()
+
+	var ungrouped []*sermoncore.ServiceStatus
+	sections := map[string][]*sermoncore.ServiceStatus{}
+	for _, service := range services {
+		names := service.Sections()
+		if len(names) == 0 {
+			ungrouped = append(ungrouped, service)
+		}
+		for _, name := range names {
+			sections[name] = append(sections[name], service)
 		}
-	} else {
-		port = DefaultPort
 	}
 
-	return &mailer.Config{
-		Username: username,
-		Password: secret.New(password),
-		Host:     host,
-		Port:     port,
-	}, nil
+	return ungrouped, sections
 }
 
-//go:embed email.tmpl
-var emailTpl string
+// sorted returns a copy of the services in the Report, sorted by name.
+func (r *Report) sorted() []*sermoncore.ServiceStatus {
+	services := make([]*sermoncore.ServiceStatus, len(r.Services))
+	copy(services, r.Services)
+	sort.SliceStable(services, func(i, j int) bool {
+		return services[i].Name < services[j].Name
+	})
+	return services
+}
 
-// getEmail parses the email template to populate a proper *mailer.Mail.
-func getEmail(to string, msg string) (*mailer.Mail, error) {
-	emailData := struct {
-		To   string
-		Body string
-	}{
-		To:   to,
-		Body: msg,
+// writeService writes a line with the status of a service. Unhealthy services
+// are followed by whatever information helps acting on them. Services failing
+// because of a dependency are left out, the root cause lists them.
+func (r *Report) writeService(sb *strings.Builder, service *sermoncore.ServiceStatus) {
+	if service.RootCause != "" {
+		return
 	}
 
-	tpl := template.Must(template.New("email").Parse(emailTpl))
-
-	var content bytes.Buffer
-	err := tpl.Execute(&content, emailData)
-	if err != nil {
-		return nil, err
+	if service.Healthy {
+		sb.WriteString(fmt.Sprintf("GET %s -> OK\n", service.Name))
+	} else {
+		sb.WriteString(fmt.Sprintf("GET %s -> ERROR: %s\n", service.Name, service.Err))
+	}
+	writeState(sb, service)
+	if service.Incident != "" {
+		sb.WriteString(fmt.Sprintf("    Incident: %s", service.Incident))
+		if service.AckedBy != "" {
+			sb.WriteString(fmt.Sprintf(", acknowledged by %s", service.AckedBy))
+		}
+		sb.WriteString("\n")
+	}
+	if affected := r.affected(service.Name); len(affected) > 0 {
+		sb.WriteString(fmt.Sprintf("    Also failing because of it: %s\n", strings.Join(affected, ", ")))
+	}
+	if service.Healthy {
+		return
 	}
 
-	return &mailer.Mail{
-		To:   []string{to},
-		Body: content.Bytes(),
-	}, nil
+	for _, step := range service.Steps {
+		result := "OK"
+		if step.Err != nil {
+			result = "ERROR"
+		}
+		sb.WriteString(fmt.Sprintf("    Step %s: %s in %s\n", step.Name, result, step.Duration.Round(time.Millisecond)))
+	}
+	if service.Timing != nil {
+		sb.WriteString(fmt.Sprintf("    Timing: %s\n", service.Timing))
+	}
+	if len(service.Redirects) > 0 {
+		sb.WriteString(fmt.Sprintf("    Redirected to: %s\n", strings.Join(service.Redirects, " -> ")))
+	}
+	if service.Description != "" {
+		sb.WriteString(fmt.Sprintf("    %s\n", service.Description))
+	}
+	if service.Owner != "" {
+		sb.WriteString(fmt.Sprintf("    Owner: %s\n", service.Owner))
+	}
+	if service.RunbookURL != "" {
+		sb.WriteString(fmt.Sprintf("    Runbook: %s\n", service.RunbookURL))
+	}
+	if service.DashboardURL != "" {
+		sb.WriteString(fmt.Sprintf("    Dashboard: %s\n", service.DashboardURL))
+	}
 }
 
-// Email sends Report via email.
-func (r *Report) Email(to string) error {
-	cfg, err := getEmailConfig()
-	if err != nil {
-		return err
+// writeState writes the state of a service if it's under maintenance, or not
+// what the result of its check alone would suggest.
+func writeState(sb *strings.Builder, service *sermoncore.ServiceStatus) {
+	if service.Maintenance {
+		sb.WriteString("    State: MAINTENANCE, alerts are suppressed")
+		if service.MaintenanceReason != "" {
+			sb.WriteString(fmt.Sprintf(" (%s)", service.MaintenanceReason))
+		}
+		sb.WriteString("\n")
+		return
 	}
 
-	var msg bytes.Buffer
-	r.Log(&msg)
-
-	email, err := getEmail(to, msg.String())
-	if err != nil {
-		return err
+	switch {
+	case service.State == sermoncore.StateFlapping:
+		sb.WriteString("    State: FLAPPING, alerts are suppressed\n")
+	case service.Healthy && service.State == sermoncore.StateDown:
+		sb.WriteString("    State: DOWN, until it recovers\n")
+	case !service.Healthy && service.State == sermoncore.StateUp:
+		sb.WriteString("    State: UP, until it keeps failing\n")
 	}
-
-	return mailer.Send(cfg, email)
 }
 
-// EmailFail sends the Report via email only if there are unhealthy services.
-func (r *Report) EmailFail(to string) error {
-	someUnhealthy := some(r.Services, func(ss *sermoncore.ServiceStatus) bool {
-		return !ss.Healthy
-	})
-
-	if someUnhealthy {
-		return r.Email(to)
+// Filter returns a new Report with only the services for which the given
+// function returns `true`.
+func (r *Report) Filter(fn func(*sermoncore.ServiceStatus) bool) *Report {
+	filtered := &Report{}
+	for _, service := range r.Services {
+		if fn(service) {
+			filtered.Add(service)
+		}
 	}
-
-	return nil
+	return filtered
 }
 
 // Some applies the given function to every element in the slice and returns
@@ -3,54 +3,14 @@ package sermonreport
 import (
 	"bytes"
 	"errors"
-	"fmt"
-	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"gitlab.com/germandv/sermon/expect"
 	"gitlab.com/germandv/sermon/sermoncore"
 )
 
-func TestGetEmail(t *testing.T) {
-	t.Run("MissingRequiredEnvVars", func(t *testing.T) {
-		config, err := getEmailConfig()
-		expect.Nil(t, config)
-		expect.Contains(t, err.Error(), "env vars must be present")
-	})
-
-	t.Run("UsesEnvVarsToPopulateConfig", func(t *testing.T) {
-		username := "some@email.io"
-		password := "abc1234"
-		host := "smtp.fastmail.com"
-		port := 486
-		os.Setenv("EMAIL_USERNAME", username)
-		os.Setenv("EMAIL_PASSWORD", password)
-		os.Setenv("EMAIL_HOST", host)
-		os.Setenv("EMAIL_PORT", fmt.Sprint(port))
-		config, err := getEmailConfig()
-		expect.NoError(t, err)
-		expect.Equal(t, config.Username, username)
-		expect.Equal(t, config.Password.Expose(), password)
-		expect.Equal(t, config.Host, host)
-		expect.Equal(t, config.Port, 486)
-		os.Unsetenv("EMAIL_USERNAME")
-		os.Unsetenv("EMAIL_PASSWORD")
-		os.Unsetenv("EMAIL_HOST")
-		os.Unsetenv("EMAIL_PORT")
-	})
-
-	t.Run("MissingOptionalEnvVarsReturnsDefaults", func(t *testing.T) {
-		os.Setenv("EMAIL_USERNAME", "some@email.io")
-		os.Setenv("EMAIL_PASSWORD", "abc1234")
-		config, err := getEmailConfig()
-		expect.NoError(t, err)
-		expect.Equal(t, config.Host, DefaultHost)
-		expect.Equal(t, config.Port, DefaultPort)
-		os.Unsetenv("EMAIL_USERNAME")
-		os.Unsetenv("EMAIL_PASSWORD")
-	})
-}
-
 func TestCreateAndLogReport(t *testing.T) {
 	report := &Report{}
 
@@ -119,3 +79,159 @@ func TestSome(t *testing.T) {
 		expect.Equal(t, hasOne, true)
 	})
 }
+
+func TestLogGroupsServices(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "archlinux.org", Healthy: true})
+	report.Add(&sermoncore.ServiceStatus{Name: "payments.prod", Healthy: true, Tags: []string{"payments", "prod"}})
+	report.Add(&sermoncore.ServiceStatus{Name: "search.staging", Healthy: false, Err: errors.New("timeout"), Tags: []string{"staging"}, Group: "search"})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	reportStr := buf.String()
+
+	expect.Contains(t, reportStr, "TOTAL: 3\nGET archlinux.org -> OK\n")
+	expect.Contains(t, reportStr, "\n[payments]\nGET payments.prod -> OK\n")
+	expect.Contains(t, reportStr, "\n[prod]\nGET payments.prod -> OK\n")
+	expect.Contains(t, reportStr, "\n[search]\nGET search.staging -> ERROR: timeout\n")
+	expect.Equal(t, strings.Contains(reportStr, "[staging]"), false)
+}
+
+func TestFilter(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "one", Healthy: true, Severity: "critical"})
+	report.Add(&sermoncore.ServiceStatus{Name: "two", Healthy: false, Severity: "warning"})
+	report.Add(&sermoncore.ServiceStatus{Name: "three", Healthy: false, Severity: "critical"})
+
+	critical := report.Filter(func(ss *sermoncore.ServiceStatus) bool {
+		return ss.Severity == "critical"
+	})
+	expect.Equal(t, len(critical.Services), 2)
+	expect.Equal(t, critical.Successful, 1)
+	expect.Equal(t, critical.Failed, 1)
+}
+
+func TestLogIncludesServiceInformation(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:         "payments.test",
+		Healthy:      false,
+		Err:          errors.New("timeout"),
+		Description:  "Payments API",
+		Owner:        "payments-team",
+		RunbookURL:   "https://wiki.test/payments",
+		DashboardURL: "https://grafana.test/payments",
+	})
+	report.Add(&sermoncore.ServiceStatus{Name: "search.test", Healthy: true, Owner: "search-team"})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	reportStr := buf.String()
+
+	expect.Contains(t, reportStr, "GET payments.test -> ERROR: timeout\n"+
+		"    Payments API\n"+
+		"    Owner: payments-team\n"+
+		"    Runbook: https://wiki.test/payments\n"+
+		"    Dashboard: https://grafana.test/payments\n")
+	expect.Equal(t, strings.Contains(reportStr, "search-team"), false)
+}
+
+func TestLogIncludesTrackedState(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "flapping.test", Healthy: true, State: sermoncore.StateFlapping})
+	report.Add(&sermoncore.ServiceStatus{Name: "recovering.test", Healthy: true, State: sermoncore.StateDown})
+	report.Add(&sermoncore.ServiceStatus{Name: "failing.test", Healthy: false, Err: errors.New("timeout"), State: sermoncore.StateUp})
+	report.Add(&sermoncore.ServiceStatus{Name: "up.test", Healthy: true, State: sermoncore.StateUp})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	reportStr := buf.String()
+
+	expect.Contains(t, reportStr, "GET flapping.test -> OK\n    State: FLAPPING, alerts are suppressed\n")
+	expect.Contains(t, reportStr, "GET recovering.test -> OK\n    State: DOWN, until it recovers\n")
+	expect.Contains(t, reportStr, "GET failing.test -> ERROR: timeout\n    State: UP, until it keeps failing\n")
+	expect.Equal(t, strings.HasSuffix(reportStr, "GET up.test -> OK\n"), true)
+}
+
+func TestLogIncludesMaintenance(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:              "db.test",
+		Healthy:           false,
+		Err:               errors.New("timeout"),
+		State:             sermoncore.StateDown,
+		Maintenance:       true,
+		MaintenanceReason: "Weekly backups",
+	})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "GET db.test -> ERROR: timeout\n    State: MAINTENANCE, alerts are suppressed (Weekly backups)\n")
+	expect.Equal(t, report.Services[0].Alerting(), false)
+}
+
+func TestLogIncludesIncident(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:     "db.test",
+		Healthy:  false,
+		Err:      errors.New("timeout"),
+		State:    sermoncore.StateDown,
+		Incident: "72eefb02",
+		AckedBy:  "jane",
+	})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "GET db.test -> ERROR: timeout\n    Incident: 72eefb02, acknowledged by jane\n")
+}
+
+func TestLogIncludesScenarioSteps(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:    "checkout",
+		Healthy: false,
+		Err:     errors.New("Step cart failed: Got status 500, want one of [{200}]"),
+		Steps: []sermoncore.StepResult{
+			{Name: "login", Duration: 120 * time.Millisecond},
+			{Name: "cart", Err: errors.New("Got status 500, want one of [{200}]"), Duration: 35 * time.Millisecond},
+		},
+	})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "    Step login: OK in 120ms\n    Step cart: ERROR in 35ms\n")
+}
+
+func TestLogIncludesTiming(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:    "api.test",
+		Healthy: false,
+		Err:     errors.New("timeout"),
+		Timing: &sermoncore.Timing{
+			DNS:       2 * time.Millisecond,
+			Connect:   10 * time.Millisecond,
+			FirstByte: 5 * time.Second,
+			Total:     5 * time.Second,
+		},
+	})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "    Timing: DNS 2ms, connect 10ms, TLS 0s, first byte 5s, total 5s\n")
+}
+
+func TestLogIncludesRedirects(t *testing.T) {
+	report := &Report{}
+	report.Add(&sermoncore.ServiceStatus{
+		Name:      "app.test",
+		Healthy:   false,
+		Err:       errors.New("Ended up at https://parked.test/, want a URL matching ^https://app"),
+		Redirects: []string{"https://app.test/", "https://parked.test/"},
+	})
+
+	var buf bytes.Buffer
+	report.Log(&buf)
+	expect.Contains(t, buf.String(), "    Redirected to: https://app.test/ -> https://parked.test/\n")
+}
@@ -0,0 +1,137 @@
+package sermonreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/mailer"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+const burnRateSubject = "Sermon SLO burn rate alert"
+
+// SLAService is the availability of a service over a window, measured against
+// its SLO.
+type SLAService struct {
+	*sermonstate.Stats
+	// SLO is the availability objective, there's none if it's zero.
+	SLO float64
+}
+
+// ErrorBudgetRemaining returns the percentage of the error budget that's left.
+func (s *SLAService) ErrorBudgetRemaining() float64 {
+	return s.Stats.ErrorBudgetRemaining(s.SLO)
+}
+
+// BurnRate returns how fast the error budget is being used up.
+func (s *SLAService) BurnRate() float64 {
+	return s.Stats.BurnRate(s.SLO)
+}
+
+// SLAReport holds the availability of every service over a window.
+type SLAReport struct {
+	From     time.Time
+	To       time.Time
+	Services []*SLAService
+}
+
+// NewSLAReport computes the availability of every service in the records of
+// the [from, to) period. slos has the objective of each service by name.
+func NewSLAReport(records []sermonstate.Record, from time.Time, to time.Time, slos map[string]float64) *SLAReport {
+	r := &SLAReport{From: from, To: to}
+	for _, stats := range sermonstate.Summarize(records) {
+		r.Services = append(r.Services, &SLAService{Stats: stats, SLO: slos[stats.Service]})
+	}
+	return r
+}
+
+// Burning returns a new SLAReport with only the services with an SLO whose
+// burn rate is at least the given threshold.
+func (r *SLAReport) Burning(threshold float64) *SLAReport {
+	burning := &SLAReport{From: r.From, To: r.To}
+	for _, s := range r.Services {
+		if s.SLO > 0 && s.BurnRate() >= threshold {
+			burning.Services = append(burning.Services, s)
+		}
+	}
+	return burning
+}
+
+// Log prints SLAReport information to the given io.Writer.
+func (r *SLAReport) Log(w io.Writer) {
+	sb := strings.Builder{}
+
+	sb.WriteString(fmt.Sprintf("From: %s\n", r.From.UTC().Format(time.RFC1123)))
+	sb.WriteString(fmt.Sprintf("To: %s\n", r.To.UTC().Format(time.RFC1123)))
+
+	for _, s := range r.Services {
+		sb.WriteString(fmt.Sprintf("%.3f%% %s", s.Uptime(), s.Service))
+		if s.SLO > 0 {
+			sb.WriteString(fmt.Sprintf(
+				" (SLO %v%%, error budget left %.1f%%, burn rate %.2f)",
+				s.SLO, s.ErrorBudgetRemaining(), s.BurnRate(),
+			))
+		}
+		sb.WriteString("\n")
+	}
+
+	fmt.Fprint(w, sb.String())
+}
+
+// JSON writes the SLAReport to the given io.Writer as JSON.
+func (r *SLAReport) JSON(w io.Writer) error {
+	type service struct {
+		Name                 string   `json:"name"`
+		Availability         float64  `json:"availability"`
+		Checks               int      `json:"checks"`
+		Failures             int      `json:"failures"`
+		SLO                  float64  `json:"slo,omitempty"`
+		ErrorBudgetRemaining *float64 `json:"error_budget_remaining,omitempty"`
+		BurnRate             *float64 `json:"burn_rate,omitempty"`
+	}
+
+	services := make([]service, 0, len(r.Services))
+	for _, s := range r.Services {
+		svc := service{
+			Name:         s.Service,
+			Availability: s.Uptime(),
+			Checks:       s.Checks,
+			Failures:     s.Failures,
+			SLO:          s.SLO,
+		}
+		if s.SLO > 0 {
+			remaining, burnRate := s.ErrorBudgetRemaining(), s.BurnRate()
+			svc.ErrorBudgetRemaining = &remaining
+			svc.BurnRate = &burnRate
+		}
+		services = append(services, svc)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		From     time.Time `json:"from"`
+		To       time.Time `json:"to"`
+		Services []service `json:"services"`
+	}{r.From.UTC(), r.To.UTC(), services})
+}
+
+// Alert emails the SLAReport to the default recipients, as an alert about the
+// services using up their error budget too quickly.
+func (r *SLAReport) Alert(config *sermonconfig.Config) error {
+	var text bytes.Buffer
+	text.WriteString("The following services are using up their error budget too quickly.\n\n")
+	r.Log(&text)
+
+	return sendMessage(config, config.DefaultRecipients(), &mailer.Message{
+		Subject: burnRateSubject,
+		Text:    text.String(),
+		HTML:    "<pre>" + html.EscapeString(text.String()) + "</pre>",
+	})
+}
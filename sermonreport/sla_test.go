@@ -0,0 +1,59 @@
+package sermonreport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+func TestSLAReport(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	var records []sermonstate.Record
+	for i := 0; i < 10; i++ {
+		checkedAt := from.Add(time.Duration(i) * 5 * time.Minute)
+		records = append(records,
+			sermonstate.Record{Time: checkedAt, Service: "down.test", Healthy: i != 3},
+			sermonstate.Record{Time: checkedAt, Service: "up.test", Healthy: true},
+			sermonstate.Record{Time: checkedAt, Service: "no-slo.test", Healthy: i%2 == 0},
+		)
+	}
+
+	report := NewSLAReport(records, from, to, map[string]float64{
+		"down.test": 99,
+		"up.test":   99.9,
+	})
+
+	t.Run("ComputesAvailability", func(t *testing.T) {
+		expect.Equal(t, len(report.Services), 3)
+		expect.Equal(t, report.Services[0].Service, "down.test")
+		expect.Equal(t, report.Services[0].Uptime(), float64(90))
+		expect.Equal(t, report.Services[2].BurnRate(), float64(0))
+	})
+
+	t.Run("BurningOnlyIncludesServicesWithAnSLO", func(t *testing.T) {
+		burning := report.Burning(1)
+		expect.Equal(t, len(burning.Services), 1)
+		expect.Equal(t, burning.Services[0].Service, "down.test")
+		expect.Equal(t, len(report.Burning(20).Services), 0)
+	})
+
+	t.Run("PrintsReportToGivenWriter", func(t *testing.T) {
+		var buf bytes.Buffer
+		report.Log(&buf)
+		expect.Contains(t, buf.String(), "90.000% down.test (SLO 99%, error budget left -900.0%, burn rate 10.00)")
+		expect.Contains(t, buf.String(), "50.000% no-slo.test\n")
+		expect.Contains(t, buf.String(), "100.000% up.test (SLO 99.9%, error budget left 100.0%, burn rate 0.00)")
+	})
+
+	t.Run("EncodesReportAsJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		expect.NoError(t, report.JSON(&buf))
+		expect.Contains(t, buf.String(), `"availability": 90,`)
+		expect.Contains(t, buf.String(), `"burn_rate": 10`)
+	})
+}
@@ -0,0 +1,45 @@
+package sermonreport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/germandv/sermon/internal/httpclient"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// postJSON posts the payload as JSON to the webhook endpoint, any status other
+// than 2xx is an error.
+func postJSON(client httpclient.HttpClient, endpoint sermoncore.Endpoint, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint.URL.String(), bytes.NewReader(body))
+	if err != nil {
+		return endpoint.Redact(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return endpoint.Redact(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook %s responded with status %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// newWebhookClient creates the client used to post to webhooks.
+func newWebhookClient() httpclient.HttpClient {
+	return httpclient.New(&http.Client{Timeout: webhookTimeout})
+}
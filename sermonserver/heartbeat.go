@@ -0,0 +1,76 @@
+package sermonserver
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+// ping handles the pings of heartbeat services: `/ping/{token}` when a run
+// succeeds, `/ping/{token}/start` when it starts and `/ping/{token}/fail` when
+// it fails, with an optional message as the body. The token authenticates
+// the service, so they don't require the admin token.
+func (s *Server) ping(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	token, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/ping/"), "/")
+	service := s.heartbeat(token)
+	if service == "" {
+		writeError(w, http.StatusNotFound, errors.New("Unknown token"))
+		return
+	}
+
+	var update func(h *sermonstate.Heartbeat, t time.Time)
+	switch action {
+	case "":
+		update = func(h *sermonstate.Heartbeat, t time.Time) { h.Ping(t) }
+	case "start":
+		update = func(h *sermonstate.Heartbeat, t time.Time) { h.Start(t) }
+	case "fail":
+		body, err := io.ReadAll(io.LimitReader(r.Body, 4096))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		message := strings.TrimSpace(string(body))
+		update = func(h *sermonstate.Heartbeat, t time.Time) { h.Fail(t, message) }
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+		return
+	}
+
+	now := time.Now()
+	err := s.store.UpdateHeartbeat(service, now, func(h *sermonstate.Heartbeat) {
+		update(h, now)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"service": service})
+}
+
+// heartbeat returns the name of the heartbeat service with the given token, or
+// an empty string if there's none.
+func (s *Server) heartbeat(token string) string {
+	if token == "" {
+		return ""
+	}
+	for name, service := range s.config.Services {
+		if !service.IsHeartbeat() {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(service.Token.Value.Expose())) == 1 {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package sermonserver
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/secret"
+	"gitlab.com/germandv/sermon/sermoncore"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+func TestPing(t *testing.T) {
+	s, _ := newTestServer(t, "admin-token")
+	s.config.Services = map[string]sermoncore.Service{
+		"backups": {Type: sermoncore.TypeHeartbeat, Token: sermoncore.Token{Value: secret.New("b4ckups")}},
+		"api":     {},
+	}
+
+	heartbeat := func() sermonstate.Heartbeat {
+		var got sermonstate.Heartbeat
+		err := s.store.UpdateHeartbeat("backups", time.Now(), func(h *sermonstate.Heartbeat) {
+			got = *h
+		})
+		expect.NoError(t, err)
+		return got
+	}
+
+	t.Run("RecordsStart", func(t *testing.T) {
+		rec := do(s, http.MethodPost, "/ping/b4ckups/start", "", "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Equal(t, heartbeat().Started != nil, true)
+	})
+
+	t.Run("RecordsFailure", func(t *testing.T) {
+		rec := do(s, http.MethodPost, "/ping/b4ckups/fail", "disk full\n", "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		h := heartbeat()
+		expect.Equal(t, h.Failed, true)
+		expect.Equal(t, h.Message, "disk full")
+		expect.Nil(t, h.Started)
+	})
+
+	t.Run("RecordsPing", func(t *testing.T) {
+		rec := do(s, http.MethodGet, "/ping/b4ckups", "", "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Contains(t, rec.Body.String(), `"service":"backups"`)
+		expect.Equal(t, heartbeat().Failed, false)
+	})
+
+	t.Run("FailsOnUnknownToken", func(t *testing.T) {
+		expect.Equal(t, do(s, http.MethodPost, "/ping/wrong", "", "").Code, http.StatusNotFound)
+		expect.Equal(t, do(s, http.MethodPost, "/ping/", "", "").Code, http.StatusNotFound)
+	})
+
+	t.Run("FailsOnUnknownAction", func(t *testing.T) {
+		expect.Equal(t, do(s, http.MethodPost, "/ping/b4ckups/other", "", "").Code, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,185 @@
+package sermonserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermonreport"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+const readHeaderTimeout = 10 * time.Second
+
+// Server serves the admin API, to manage the state kept in the Store, and
+// the metrics of the last run, and receives the pings of heartbeat services.
+type Server struct {
+	config *sermonconfig.Config
+	store  *sermonstate.Store
+	mux    *http.ServeMux
+
+	mu     sync.Mutex
+	report *sermonreport.Report
+}
+
+// New creates a Server of the state in the given Store.
+func New(config *sermonconfig.Config, store *sermonstate.Store) *Server {
+	s := &Server{config: config, store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/incidents", s.authorized(s.listIncidents))
+	s.mux.HandleFunc("/incidents/", s.authorized(s.incident))
+	s.mux.HandleFunc("/metrics", s.authorized(s.metrics))
+	s.mux.HandleFunc("/ping/", s.ping)
+	return s
+}
+
+// Observe keeps the Report of the last run, to serve its metrics.
+func (s *Server) Observe(report *sermonreport.Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.report = report
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// ListenAndServe listens on the address in the server settings and serves the
+// admin API.
+func (s *Server) ListenAndServe() error {
+	srv := &http.Server{
+		Addr:              s.config.Server.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+	return srv.ListenAndServe()
+}
+
+// authorized requires the token in the server settings, if any, as a bearer
+// token.
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := s.config.Server.Token.Value.Expose()
+		if token != "" {
+			given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, errors.New("Invalid or missing token"))
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// listIncidents lists the open incidents, or all of them with `?all=true`.
+func (s *Server) listIncidents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	incidents, err := s.store.Incidents()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	all := r.URL.Query().Get("all") == "true"
+	listed := make([]*sermonstate.Incident, 0, len(incidents))
+	for _, i := range incidents {
+		if all || i.IsOpen() {
+			listed = append(listed, i)
+		}
+	}
+	writeJSON(w, http.StatusOK, listed)
+}
+
+// incident handles `GET /incidents/{id}` and `POST /incidents/{id}/ack`.
+func (s *Server) incident(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/incidents/"), "/")
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.getIncident(w, parts[0])
+	case len(parts) == 2 && parts[1] == "ack" && r.Method == http.MethodPost:
+		s.ackIncident(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+func (s *Server) getIncident(w http.ResponseWriter, id string) {
+	incidents, err := s.store.Incidents()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	for _, i := range incidents {
+		if i.ID == id {
+			writeJSON(w, http.StatusOK, i)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, sermonstate.ErrUnknownIncident)
+}
+
+// ackIncident acknowledges an incident, the body is a JSON object with who
+// acknowledges it and a note: `{"by": "jane", "note": "On it"}`.
+func (s *Server) ackIncident(w http.ResponseWriter, r *http.Request, id string) {
+	var ack struct {
+		By   string `json:"by"`
+		Note string `json:"note"`
+	}
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&ack)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	incident, err := s.store.Acknowledge(id, ack.By, ack.Note)
+	switch {
+	case errors.Is(err, sermonstate.ErrUnknownIncident):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, sermonstate.ErrResolvedIncident):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeJSON(w, http.StatusOK, incident)
+	}
+}
+
+// metrics serves the metrics of the last run in the Prometheus text format,
+// there are none until the first run finishes.
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	s.mu.Lock()
+	report := s.report
+	s.mu.Unlock()
+	if report == nil {
+		report = &sermonreport.Report{}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = report.Metrics(w)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
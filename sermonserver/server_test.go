@@ -0,0 +1,109 @@
+package sermonserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/internal/secret"
+	"gitlab.com/germandv/sermon/sermonconfig"
+	"gitlab.com/germandv/sermon/sermoncore"
+	"gitlab.com/germandv/sermon/sermonreport"
+	"gitlab.com/germandv/sermon/sermonstate"
+)
+
+func newTestServer(t *testing.T, token string) (*Server, *sermonstate.Incident) {
+	t.Helper()
+	store, err := sermonstate.Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	resolved := sermonstate.NewIncident("a.test", time.Now())
+	resolved.Resolve(time.Now())
+	open := sermonstate.NewIncident("b.test", time.Now())
+	err = store.UpdateIncidents(func(incidents []*sermonstate.Incident) ([]*sermonstate.Incident, error) {
+		return append(incidents, resolved, open), nil
+	})
+	expect.NoError(t, err)
+
+	config := &sermonconfig.Config{}
+	config.Server.Token.Value = secret.New(token)
+	return New(config, store), open
+}
+
+func do(s *Server, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIncidents(t *testing.T) {
+	s, open := newTestServer(t, "")
+
+	t.Run("ListsOpenIncidents", func(t *testing.T) {
+		rec := do(s, http.MethodGet, "/incidents", "", "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Contains(t, rec.Body.String(), `"service":"b.test"`)
+		expect.Equal(t, strings.Contains(rec.Body.String(), "a.test"), false)
+	})
+
+	t.Run("ListsAllIncidents", func(t *testing.T) {
+		rec := do(s, http.MethodGet, "/incidents?all=true", "", "")
+		expect.Contains(t, rec.Body.String(), `"service":"a.test"`)
+	})
+
+	t.Run("GetsIncident", func(t *testing.T) {
+		rec := do(s, http.MethodGet, "/incidents/"+open.ID, "", "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Contains(t, rec.Body.String(), open.ID)
+	})
+
+	t.Run("AcknowledgesIncident", func(t *testing.T) {
+		rec := do(s, http.MethodPost, "/incidents/"+open.ID+"/ack", `{"by": "jane", "note": "On it"}`, "")
+		expect.Equal(t, rec.Code, http.StatusOK)
+		expect.Contains(t, rec.Body.String(), `"by":"jane"`)
+	})
+
+	t.Run("FailsOnUnknownIncident", func(t *testing.T) {
+		rec := do(s, http.MethodPost, "/incidents/missing/ack", `{"by": "jane"}`, "")
+		expect.Equal(t, rec.Code, http.StatusNotFound)
+	})
+
+	t.Run("FailsWithoutWhoAcknowledges", func(t *testing.T) {
+		rec := do(s, http.MethodPost, "/incidents/"+open.ID+"/ack", `{}`, "")
+		expect.Equal(t, rec.Code, http.StatusBadRequest)
+	})
+}
+
+func TestToken(t *testing.T) {
+	s, _ := newTestServer(t, "s3cr3t")
+
+	expect.Equal(t, do(s, http.MethodGet, "/incidents", "", "").Code, http.StatusUnauthorized)
+	expect.Equal(t, do(s, http.MethodGet, "/incidents", "", "wrong").Code, http.StatusUnauthorized)
+	expect.Equal(t, do(s, http.MethodGet, "/incidents", "", "s3cr3t").Code, http.StatusOK)
+}
+
+func TestMetrics(t *testing.T) {
+	s, _ := newTestServer(t, "t0k3n")
+
+	rec := do(s, http.MethodGet, "/metrics", "", "")
+	expect.Equal(t, rec.Code, http.StatusUnauthorized)
+
+	rec = do(s, http.MethodGet, "/metrics", "", "t0k3n")
+	expect.Equal(t, rec.Code, http.StatusOK)
+	expect.Equal(t, strings.Contains(rec.Body.String(), "sermon_up{"), false)
+
+	report := &sermonreport.Report{}
+	report.Add(&sermoncore.ServiceStatus{Name: "api.test", Healthy: true})
+	s.Observe(report)
+
+	rec = do(s, http.MethodGet, "/metrics", "", "t0k3n")
+	expect.Contains(t, rec.Body.String(), "sermon_up{service=\"api.test\"} 1\n")
+}
@@ -0,0 +1,69 @@
+package sermonstate
+
+import (
+	"sort"
+	"time"
+)
+
+const burnAlertFile = "burn_alert.json"
+
+// BurnAlert is the last alert about services using up their error budget too
+// quickly.
+type BurnAlert struct {
+	Services []string  `json:"services,omitempty"`
+	Sent     time.Time `json:"sent,omitempty"`
+}
+
+// Due checks if the given services, burning their budget at time t, should
+// be alerted on: they're not the ones of the last alert, or it was sent at
+// least cooldown ago.
+func (a BurnAlert) Due(services []string, t time.Time, cooldown time.Duration) bool {
+	if len(services) == 0 {
+		return false
+	}
+	return !sameNames(a.Services, services) || t.Sub(a.Sent) >= cooldown
+}
+
+// sameNames checks if both lists have the same names, in any order.
+func sameNames(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string(nil), a...)
+	sortedB := append([]string(nil), b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertBurning calls send if the given services, burning their budget at time
+// t, are Due an alert, and records it once sent. With no services the last
+// alert is cleared. The last alert is locked, across processes too, from the
+// check until it's recorded, so the same alert isn't sent twice.
+func (s *Store) AlertBurning(services []string, t time.Time, cooldown time.Duration, send func() error) error {
+	return s.locked(burnAlertFile, func() error {
+		var last BurnAlert
+		if err := s.readJSON(burnAlertFile, &last); err != nil {
+			return err
+		}
+
+		if len(services) == 0 {
+			if len(last.Services) > 0 {
+				return s.writeJSON(burnAlertFile, BurnAlert{})
+			}
+			return nil
+		}
+		if !last.Due(services, t, cooldown) {
+			return nil
+		}
+		if err := send(); err != nil {
+			return err
+		}
+		return s.writeJSON(burnAlertFile, BurnAlert{Services: services, Sent: t.UTC()})
+	})
+}
@@ -0,0 +1,49 @@
+package sermonstate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestBurnAlertDue(t *testing.T) {
+	t.Parallel()
+	sent := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	alert := BurnAlert{Services: []string{"a.test", "b.test"}, Sent: sent}
+
+	expect.Equal(t, BurnAlert{}.Due([]string{"a.test"}, sent, time.Hour), true)
+	expect.Equal(t, alert.Due(nil, sent, time.Hour), false)
+	expect.Equal(t, alert.Due([]string{"b.test", "a.test"}, sent.Add(30*time.Minute), time.Hour), false)
+	expect.Equal(t, alert.Due([]string{"a.test"}, sent.Add(30*time.Minute), time.Hour), true)
+	expect.Equal(t, alert.Due([]string{"a.test", "b.test"}, sent.Add(time.Hour), time.Hour), true)
+}
+
+func TestStoreAlertBurning(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	sent := 0
+	send := func() error {
+		sent++
+		return nil
+	}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expect.NoError(t, store.AlertBurning([]string{"a.test"}, at, time.Hour, send))
+	expect.NoError(t, store.AlertBurning([]string{"a.test"}, at.Add(time.Minute), time.Hour, send))
+	expect.Equal(t, sent, 1)
+
+	expect.NoError(t, store.AlertBurning(nil, at.Add(2*time.Minute), time.Hour, send))
+	expect.NoError(t, store.AlertBurning([]string{"a.test"}, at.Add(3*time.Minute), time.Hour, send))
+	expect.Equal(t, sent, 2)
+
+	failed := errors.New("failed")
+	err = store.AlertBurning([]string{"b.test"}, at.Add(4*time.Minute), time.Hour, func() error { return failed })
+	expect.Equal(t, errors.Is(err, failed), true)
+	expect.NoError(t, store.AlertBurning([]string{"b.test"}, at.Add(5*time.Minute), time.Hour, send))
+	expect.Equal(t, sent, 3)
+}
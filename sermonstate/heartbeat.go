@@ -0,0 +1,124 @@
+package sermonstate
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	heartbeatsFile = "heartbeats.json"
+	// maxFailureMessage is the length of the message kept of a failed run.
+	maxFailureMessage = 1024
+)
+
+// Heartbeat is the state of a heartbeat service, built from its pings.
+type Heartbeat struct {
+	// Created is when the service was first checked, it's down if it
+	// doesn't ping within its period from then on.
+	Created  time.Time `json:"created"`
+	LastPing time.Time `json:"last_ping,omitempty"`
+	// Started is when the current run started, if it signaled its start.
+	Started *time.Time `json:"started,omitempty"`
+	// DurationMs is how long the last run took, if it signaled its start.
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// Failed is set if the last run signaled its failure, with a message.
+	Failed  bool   `json:"failed,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Ping records a successful run at time t.
+func (h *Heartbeat) Ping(t time.Time) {
+	h.finish(t)
+	h.Failed = false
+	h.Message = ""
+}
+
+// Start records the start of a run at time t.
+func (h *Heartbeat) Start(t time.Time) {
+	started := t.UTC()
+	h.Started = &started
+}
+
+// Fail records a failed run at time t, with a message about it.
+func (h *Heartbeat) Fail(t time.Time, message string) {
+	h.finish(t)
+	if len(message) > maxFailureMessage {
+		message = message[:maxFailureMessage]
+	}
+	h.Failed = true
+	h.Message = message
+}
+
+func (h *Heartbeat) finish(t time.Time) {
+	h.LastPing = t.UTC()
+	if h.Started != nil {
+		h.DurationMs = t.Sub(*h.Started).Milliseconds()
+		h.Started = nil
+	}
+}
+
+// Check checks the heartbeat at time t: it fails if the last run failed, or
+// there's been no ping within the deadline.
+func (h *Heartbeat) Check(t time.Time, deadline time.Duration) error {
+	if h.Failed {
+		if h.Message != "" {
+			return fmt.Errorf("Run failed at %s: %s", h.LastPing.Format(time.RFC1123), h.Message)
+		}
+		return fmt.Errorf("Run failed at %s", h.LastPing.Format(time.RFC1123))
+	}
+
+	if h.LastPing.IsZero() {
+		if t.Sub(h.Created) > deadline {
+			return fmt.Errorf("No ping received in %s", deadline)
+		}
+		return nil
+	}
+
+	if t.Sub(h.LastPing) > deadline {
+		return fmt.Errorf("No ping received in %s, the last one was at %s", deadline, h.LastPing.Format(time.RFC1123))
+	}
+	return nil
+}
+
+// Heartbeat returns the heartbeat of a service, it's created at time t if it
+// doesn't exist yet. Existing heartbeats are only read, so pings recorded
+// meanwhile by another process aren't overwritten.
+func (s *Store) Heartbeat(service string, t time.Time) (Heartbeat, error) {
+	var heartbeat Heartbeat
+	err := s.locked(heartbeatsFile, func() error {
+		heartbeats := map[string]*Heartbeat{}
+		if err := s.readJSON(heartbeatsFile, &heartbeats); err != nil {
+			return err
+		}
+
+		if h, ok := heartbeats[service]; ok {
+			heartbeat = *h
+			return nil
+		}
+		heartbeat = Heartbeat{Created: t.UTC()}
+		heartbeats[service] = &heartbeat
+		return s.writeJSON(heartbeatsFile, heartbeats)
+	})
+	return heartbeat, err
+}
+
+// UpdateHeartbeat updates the heartbeat of a service with fn, it's created at
+// time t if it doesn't exist yet. The heartbeats are locked, across processes
+// too, while fn runs.
+func (s *Store) UpdateHeartbeat(service string, t time.Time, fn func(h *Heartbeat)) error {
+	return s.locked(heartbeatsFile, func() error {
+		heartbeats := map[string]*Heartbeat{}
+		if err := s.readJSON(heartbeatsFile, &heartbeats); err != nil {
+			return err
+		}
+
+		h, ok := heartbeats[service]
+		if !ok {
+			h = &Heartbeat{Created: t.UTC()}
+			heartbeats[service] = h
+		}
+		fn(h)
+
+		return s.writeJSON(heartbeatsFile, heartbeats)
+	})
+}
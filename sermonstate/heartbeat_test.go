@@ -0,0 +1,74 @@
+package sermonstate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return created.Add(time.Duration(minutes) * time.Minute)
+	}
+	deadline := 30 * time.Minute
+	h := &Heartbeat{Created: created}
+
+	t.Run("WaitsForFirstPing", func(t *testing.T) {
+		expect.NoError(t, h.Check(at(30), deadline))
+		expect.Contains(t, h.Check(at(31), deadline).Error(), "No ping received in 30m0s")
+	})
+
+	t.Run("RecordsRunDuration", func(t *testing.T) {
+		h.Start(at(40))
+		h.Ping(at(45))
+		expect.Equal(t, h.DurationMs, (5 * time.Minute).Milliseconds())
+		expect.Nil(t, h.Started)
+		expect.NoError(t, h.Check(at(75), deadline))
+		expect.Contains(t, h.Check(at(76), deadline).Error(), "the last one was at")
+	})
+
+	t.Run("RecordsFailure", func(t *testing.T) {
+		h.Start(at(80))
+		h.Fail(at(81), strings.Repeat("x", maxFailureMessage+1))
+		expect.Equal(t, len(h.Message), maxFailureMessage)
+		expect.Contains(t, h.Check(at(82), deadline).Error(), "Run failed at")
+
+		h.Ping(at(90))
+		expect.NoError(t, h.Check(at(91), deadline))
+	})
+}
+
+func TestStoreHeartbeats(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	expect.NoError(t, store.UpdateHeartbeat("backups", created, func(h *Heartbeat) {}))
+	expect.NoError(t, store.UpdateHeartbeat("backups", created.Add(time.Hour), func(h *Heartbeat) {
+		h.Ping(created.Add(time.Hour))
+	}))
+
+	var got Heartbeat
+	expect.NoError(t, store.UpdateHeartbeat("backups", created.Add(2*time.Hour), func(h *Heartbeat) {
+		got = *h
+	}))
+	expect.Equal(t, got.Created, created)
+	expect.Equal(t, got.LastPing, created.Add(time.Hour))
+
+	got, err = store.Heartbeat("backups", created.Add(3*time.Hour))
+	expect.NoError(t, err)
+	expect.Equal(t, got.LastPing, created.Add(time.Hour))
+
+	got, err = store.Heartbeat("reports", created)
+	expect.NoError(t, err)
+	expect.Equal(t, got.Created, created)
+	got, err = store.Heartbeat("reports", created.Add(time.Hour))
+	expect.NoError(t, err)
+	expect.Equal(t, got.Created, created)
+}
@@ -0,0 +1,170 @@
+package sermonstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	incidentsFile = "incidents.json"
+	// maxIncidentErrors is the number of errors kept per incident, the most
+	// recent ones.
+	maxIncidentErrors = 10
+)
+
+var (
+	ErrUnknownIncident  = errors.New("Unknown incident")
+	ErrResolvedIncident = errors.New("Already resolved incident")
+)
+
+// Incident is a period in which a service is DOWN.
+type Incident struct {
+	ID      string `json:"id"`
+	Service string `json:"service"`
+	// ConfigName is the name of the service in the config, if it differs
+	// from Service because it's checked over both IP versions.
+	ConfigName string     `json:"config_name,omitempty"`
+	Opened     time.Time  `json:"opened"`
+	Resolved   *time.Time `json:"resolved,omitempty"`
+	// Attempts is the number of failing checks during the incident.
+	Attempts int       `json:"attempts"`
+	Errors   []Failure `json:"errors,omitempty"`
+	Ack      *Ack      `json:"ack,omitempty"`
+	// Escalated is the number of levels of its escalation policy that have
+	// been notified.
+	Escalated int `json:"escalated,omitempty"`
+}
+
+// Failure is the error of a failing check.
+type Failure struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// Ack is the acknowledgement of an incident by someone working on it.
+type Ack struct {
+	By   string    `json:"by"`
+	Note string    `json:"note,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// NewIncident opens an incident of a service at time t.
+func NewIncident(service string, t time.Time) *Incident {
+	return &Incident{ID: newID(), Service: service, Opened: t.UTC()}
+}
+
+// IsOpen checks if the incident hasn't been resolved.
+func (i *Incident) IsOpen() bool {
+	return i.Resolved == nil
+}
+
+// Fail records a failing check at time t.
+func (i *Incident) Fail(t time.Time, err string) {
+	i.Attempts++
+	i.Errors = append(i.Errors, Failure{Time: t.UTC(), Error: err})
+	if len(i.Errors) > maxIncidentErrors {
+		i.Errors = i.Errors[len(i.Errors)-maxIncidentErrors:]
+	}
+}
+
+// Acknowledge acknowledges the incident, by someone with a note.
+func (i *Incident) Acknowledge(by string, note string, t time.Time) error {
+	if by == "" {
+		return errors.New("Missing who acknowledges the incident")
+	}
+	if !i.IsOpen() {
+		return fmt.Errorf("%w %s", ErrResolvedIncident, i.ID)
+	}
+	i.Ack = &Ack{By: by, Note: note, Time: t.UTC()}
+	return nil
+}
+
+// Resolve resolves the incident at time t.
+func (i *Incident) Resolve(t time.Time) {
+	resolved := t.UTC()
+	i.Resolved = &resolved
+}
+
+// BaseName returns the name in the config of the service of the incident,
+// ie: `api` for `api (IPv6)`.
+func (i *Incident) BaseName() string {
+	if i.ConfigName != "" {
+		return i.ConfigName
+	}
+	return i.Service
+}
+
+// OpenIncident returns the open incident of a service, or nil if there's none.
+func OpenIncident(incidents []*Incident, service string) *Incident {
+	for _, i := range incidents {
+		if i.Service == service && i.IsOpen() {
+			return i
+		}
+	}
+	return nil
+}
+
+// OpenIncidents returns the open incidents of a service, given its name or
+// its name in the config, which matches the incidents of every IP version it's
+// checked over.
+func OpenIncidents(incidents []*Incident, service string) []*Incident {
+	var open []*Incident
+	for _, i := range incidents {
+		if (i.Service == service || i.BaseName() == service) && i.IsOpen() {
+			open = append(open, i)
+		}
+	}
+	return open
+}
+
+// Incidents returns every incident, oldest first.
+func (s *Store) Incidents() ([]*Incident, error) {
+	var incidents []*Incident
+	err := s.locked(incidentsFile, func() error {
+		return s.readJSON(incidentsFile, &incidents)
+	})
+	return incidents, err
+}
+
+// UpdateIncidents replaces the incidents with the ones returned by fn, which
+// is given the current ones. Nothing is saved if fn fails. The incidents are
+// locked, across processes too, while fn runs, so it should be quick.
+func (s *Store) UpdateIncidents(fn func(incidents []*Incident) ([]*Incident, error)) error {
+	return s.locked(incidentsFile, func() error {
+		var incidents []*Incident
+		if err := s.readJSON(incidentsFile, &incidents); err != nil {
+			return err
+		}
+
+		incidents, err := fn(incidents)
+		if err != nil {
+			return err
+		}
+		return s.writeJSON(incidentsFile, incidents)
+	})
+}
+
+// Acknowledge acknowledges an incident by ID.
+func (s *Store) Acknowledge(id string, by string, note string) (*Incident, error) {
+	var acked *Incident
+	err := s.UpdateIncidents(func(incidents []*Incident) ([]*Incident, error) {
+		for _, i := range incidents {
+			if i.ID == id {
+				acked = i
+				return incidents, i.Acknowledge(by, note, time.Now())
+			}
+		}
+		return nil, fmt.Errorf("%w %s", ErrUnknownIncident, id)
+	})
+	return acked, err
+}
+
+// newID generates a short random ID.
+func newID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,73 @@
+package sermonstate
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestIncident(t *testing.T) {
+	t.Parallel()
+	opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	incident := NewIncident("a.test", opened)
+	expect.Equal(t, incident.IsOpen(), true)
+
+	for i := 0; i < maxIncidentErrors+2; i++ {
+		incident.Fail(opened.Add(time.Duration(i)*time.Minute), fmt.Sprintf("error %d", i))
+	}
+	expect.Equal(t, incident.Attempts, maxIncidentErrors+2)
+	expect.Equal(t, len(incident.Errors), maxIncidentErrors)
+	expect.Equal(t, incident.Errors[0].Error, "error 2")
+
+	err := incident.Acknowledge("", "", opened)
+	expect.Contains(t, err.Error(), "Missing who acknowledges")
+
+	expect.NoError(t, incident.Acknowledge("jane", "On it", opened.Add(time.Hour)))
+	expect.Equal(t, incident.Ack.By, "jane")
+
+	incident.Resolve(opened.Add(2 * time.Hour))
+	expect.Equal(t, incident.IsOpen(), false)
+	err = incident.Acknowledge("john", "", opened)
+	expect.Equal(t, errors.Is(err, ErrResolvedIncident), true)
+}
+
+func TestStoreIncidents(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	resolved := NewIncident("a.test", time.Now())
+	resolved.Resolve(time.Now())
+	open := NewIncident("a.test", time.Now())
+
+	err = store.UpdateIncidents(func(incidents []*Incident) ([]*Incident, error) {
+		return append(incidents, resolved, open), nil
+	})
+	expect.NoError(t, err)
+
+	incidents, err := store.Incidents()
+	expect.NoError(t, err)
+	expect.Equal(t, len(incidents), 2)
+	expect.Equal(t, OpenIncident(incidents, "a.test").ID, open.ID)
+	expect.Nil(t, OpenIncident(incidents, "b.test"))
+	expect.Equal(t, len(OpenIncidents(incidents, "a.test")), 1)
+
+	t.Run("AcknowledgesByID", func(t *testing.T) {
+		acked, err := store.Acknowledge(open.ID, "jane", "On it")
+		expect.NoError(t, err)
+		expect.Equal(t, acked.Ack.Note, "On it")
+
+		incidents, err := store.Incidents()
+		expect.NoError(t, err)
+		expect.Equal(t, incidents[1].Ack.By, "jane")
+	})
+
+	t.Run("FailsOnUnknownIncident", func(t *testing.T) {
+		_, err := store.Acknowledge("missing", "jane", "")
+		expect.Equal(t, errors.Is(err, ErrUnknownIncident), true)
+	})
+}
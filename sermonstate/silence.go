@@ -0,0 +1,94 @@
+package sermonstate
+
+import "time"
+
+const silencesFile = "silences.json"
+
+// Silence suppresses notifications about a service for a while.
+type Silence struct {
+	ID      string    `json:"id"`
+	Service string    `json:"service"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Reason  string    `json:"reason,omitempty"`
+}
+
+// NewSilence creates a Silence of a service, from now on for the given
+// duration.
+func NewSilence(service string, d time.Duration, reason string) Silence {
+	start := time.Now().UTC()
+	return Silence{
+		ID:      newID(),
+		Service: service,
+		Start:   start,
+		End:     start.Add(d),
+		Reason:  reason,
+	}
+}
+
+// Active checks if the silence is in place at time t.
+func (s *Silence) Active(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// Silences returns the silences that haven't ended by time t.
+func (s *Store) Silences(t time.Time) ([]Silence, error) {
+	var silences []Silence
+	err := s.locked(silencesFile, func() error {
+		var err error
+		silences, err = s.silences(t)
+		return err
+	})
+	return silences, err
+}
+
+// AddSilence adds a silence, dropping the ones that have already ended. The
+// silences are locked, across processes too, while they're updated.
+func (s *Store) AddSilence(silence Silence) error {
+	return s.locked(silencesFile, func() error {
+		silences, err := s.silences(time.Now())
+		if err != nil {
+			return err
+		}
+		return s.writeJSON(silencesFile, append(silences, silence))
+	})
+}
+
+// RemoveSilence removes a silence by ID, it reports whether it was found.
+func (s *Store) RemoveSilence(id string) (bool, error) {
+	found := false
+	err := s.locked(silencesFile, func() error {
+		silences, err := s.silences(time.Now())
+		if err != nil {
+			return err
+		}
+
+		kept := silences[:0]
+		for _, silence := range silences {
+			if silence.ID != id {
+				kept = append(kept, silence)
+			}
+		}
+		if len(kept) == len(silences) {
+			return nil
+		}
+		found = true
+		return s.writeJSON(silencesFile, kept)
+	})
+	return found, err
+}
+
+func (s *Store) silences(t time.Time) ([]Silence, error) {
+	var all []Silence
+	if err := s.readJSON(silencesFile, &all); err != nil {
+		return nil, err
+	}
+
+	current := make([]Silence, 0, len(all))
+	for _, silence := range all {
+		if silence.End.After(t) {
+			current = append(current, silence)
+		}
+	}
+	return current, nil
+}
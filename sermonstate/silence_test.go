@@ -0,0 +1,42 @@
+package sermonstate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestStoreSilences(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	silence := NewSilence("a.test", 2*time.Hour, "Deploy")
+	expect.Equal(t, silence.Active(time.Now()), true)
+	expect.Equal(t, silence.Active(time.Now().Add(3*time.Hour)), false)
+
+	expired := NewSilence("b.test", time.Hour, "")
+	expired.End = time.Now().Add(-time.Minute)
+	expect.NoError(t, store.AddSilence(expired))
+	expect.NoError(t, store.AddSilence(silence))
+
+	silences, err := store.Silences(time.Now())
+	expect.NoError(t, err)
+	expect.Equal(t, len(silences), 1)
+	expect.Equal(t, silences[0].Service, "a.test")
+	expect.Equal(t, silences[0].Reason, "Deploy")
+
+	found, err := store.RemoveSilence("missing")
+	expect.NoError(t, err)
+	expect.Equal(t, found, false)
+
+	found, err = store.RemoveSilence(silence.ID)
+	expect.NoError(t, err)
+	expect.Equal(t, found, true)
+
+	silences, err = store.Silences(time.Now())
+	expect.NoError(t, err)
+	expect.Equal(t, len(silences), 0)
+}
@@ -0,0 +1,322 @@
+package sermonstate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+const historyFile = "history.jsonl"
+
+// Record is the result of checking a service once.
+type Record struct {
+	Time       time.Time  `json:"time"`
+	Service    string     `json:"service"`
+	Healthy    bool       `json:"healthy"`
+	Error      string     `json:"error,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+	CertExpiry *time.Time `json:"cert_expiry,omitempty"`
+}
+
+// NewRecord creates a Record of the given ServiceStatus, checked at time t.
+func NewRecord(ss *sermoncore.ServiceStatus, t time.Time) Record {
+	r := Record{
+		Time:       t.UTC(),
+		Service:    ss.Name,
+		Healthy:    ss.Healthy,
+		DurationMs: ss.Duration.Milliseconds(),
+	}
+	if ss.Err != nil {
+		r.Error = ss.Err.Error()
+	}
+	if !ss.CertExpiry.IsZero() {
+		expiry := ss.CertExpiry.UTC()
+		r.CertExpiry = &expiry
+	}
+	return r
+}
+
+// Store keeps the history of checks in a directory, so it can be reported on
+// across runs.
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var (
+	storesMu sync.Mutex
+	// stores are the open stores by directory, so there's a single one, and
+	// a single lock, per directory in the process.
+	stores = map[string]*Store{}
+)
+
+// Open opens the Store in the given directory, creating it if needed.
+func Open(dir string) (*Store, error) {
+	dir = filepath.Clean(dir)
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	if s, ok := stores[dir]; ok {
+		return s, nil
+	}
+
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{dir: dir}
+	stores[dir] = s
+	return s, nil
+}
+
+// Append adds records to the history. They're written at once holding the
+// lock of the history, so lines of other processes can't interleave with
+// them.
+func (s *Store) Append(records ...Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return s.locked(historyFile, func() error {
+		f, err := os.OpenFile(filepath.Join(s.dir, historyFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			return err
+		}
+		if _, err = f.Write(buf.Bytes()); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// History returns the records checked in the [from, to) period, oldest first.
+// Lines that can't be decoded, ie: left halfway by a crash, are skipped. As
+// records are appended in time order, reading starts at the first one of the
+// period, so recent periods are read quickly however long the history is.
+func (s *Store) History(from time.Time, to time.Time) ([]Record, error) {
+	var records []Record
+	err := s.locked(historyFile, func() error {
+		f, err := os.Open(filepath.Join(s.dir, historyFile))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		offset, err := seekRecord(f, from.Add(-historySkew))
+		if err != nil {
+			return err
+		}
+		r := bufio.NewReader(io.NewSectionReader(f, offset, math.MaxInt64-offset))
+		for {
+			record, _, ok, err := readRecord(r)
+			if ok && record.Time.After(to.Add(historySkew)) {
+				return nil
+			}
+			if ok && !record.Time.Before(from) && record.Time.Before(to) {
+				records = append(records, record)
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// Prune drops the records checked before the given time from the history. To
+// not rewrite the history on every run, it's only done once the oldest record
+// is a day older than that.
+func (s *Store) Prune(before time.Time) error {
+	return s.locked(historyFile, func() error {
+		f, err := os.Open(filepath.Join(s.dir, historyFile))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, oldest, ok, err := recordFrom(f, 0)
+		if err != nil || !ok || !oldest.Time.Before(before.Add(-pruneSlack)) {
+			return err
+		}
+
+		offset, err := seekRecord(f, before)
+		if err != nil {
+			return err
+		}
+		return s.writeFile(historyFile, io.NewSectionReader(f, offset, math.MaxInt64-offset))
+	})
+}
+
+// pruneSlack is how much older than needed the history is let grow before
+// it's pruned.
+const pruneSlack = 24 * time.Hour
+
+// historySkew is how much out of time order records may be appended, ie: by
+// runs of different processes at the same time.
+const historySkew = time.Minute
+
+// readRecord reads the next line of the history and returns its length, ok is
+// false if it can't be decoded.
+func readRecord(r *bufio.Reader) (Record, int64, bool, error) {
+	line, err := r.ReadBytes('\n')
+	var record Record
+	ok := len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &record) == nil
+	return record, int64(len(line)), ok, err
+}
+
+// seekRecord returns the offset of the line of the first record checked at or
+// after t, by binary search over the history file, or its size if there's
+// none.
+func seekRecord(f *os.File, t time.Time) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, record, ok, err := recordFrom(f, mid)
+		if err != nil {
+			return 0, err
+		}
+		if !ok || !record.Time.Before(t) {
+			hi = mid
+		} else {
+			lo = start + 1
+		}
+	}
+	start, _, _, err := recordFrom(f, lo)
+	return start, err
+}
+
+// recordFrom returns the first record that can be decoded on a line starting
+// at or after offset, and the offset of that line. ok is false if there's
+// none.
+func recordFrom(f *os.File, offset int64) (int64, Record, bool, error) {
+	start := offset
+	if offset > 0 {
+		// Skip the rest of the line offset is in, unless it starts there.
+		start = offset - 1
+	}
+	r := bufio.NewReader(io.NewSectionReader(f, start, math.MaxInt64-start))
+	if offset > 0 {
+		skipped, err := r.ReadBytes('\n')
+		start += int64(len(skipped))
+		if errors.Is(err, io.EOF) {
+			return start, Record{}, false, nil
+		}
+		if err != nil {
+			return 0, Record{}, false, err
+		}
+	}
+
+	for {
+		record, n, ok, err := readRecord(r)
+		if ok {
+			return start, record, true, nil
+		}
+		start += n
+		if errors.Is(err, io.EOF) {
+			return start, Record{}, false, nil
+		}
+		if err != nil {
+			return 0, Record{}, false, err
+		}
+	}
+}
+
+// locked runs fn holding the lock of the Store and a lock file next to the
+// given file, so other processes using the same directory, ie: a cron run and
+// the daemon, wait for each other too.
+func (s *Store) locked(name string, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(s.dir, name+".lock"), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = lockFile(f); err != nil {
+		return err
+	}
+	defer unlockFile(f)
+
+	return fn()
+}
+
+// readJSON decodes a JSON file in the Store into v, it's left untouched if the
+// file does not exist.
+func (s *Store) readJSON(name string, v interface{}) error {
+	content, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// writeJSON encodes v into a JSON file in the Store. It's written to a
+// temporary file first and renamed, so a crash never leaves it half written.
+func (s *Store) writeJSON(name string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.writeFile(name, bytes.NewReader(content))
+}
+
+// writeFile replaces the given file with the content of r, atomically.
+func (s *Store) writeFile(name string, r io.Reader) error {
+	tmp, err := os.CreateTemp(s.dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
@@ -0,0 +1,143 @@
+package sermonstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestNewRecord(t *testing.T) {
+	t.Parallel()
+	expiry := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	checkedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	r := NewRecord(&sermoncore.ServiceStatus{
+		Name:       "bad.test",
+		Healthy:    false,
+		Err:        errors.New("Timeout"),
+		Duration:   1500 * time.Millisecond,
+		CertExpiry: expiry,
+	}, checkedAt)
+
+	expect.Equal(t, r.Service, "bad.test")
+	expect.Equal(t, r.Healthy, false)
+	expect.Equal(t, r.Error, "Timeout")
+	expect.Equal(t, r.DurationMs, int64(1500))
+	expect.Equal(t, *r.CertExpiry, expiry)
+	expect.Equal(t, r.Time, checkedAt)
+
+	r = NewRecord(&sermoncore.ServiceStatus{Name: "good.test", Healthy: true}, checkedAt)
+	expect.Equal(t, r.Error, "")
+	expect.Nil(t, r.CertExpiry)
+}
+
+func TestStoreHistory(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	t.Run("EmptyHistory", func(t *testing.T) {
+		records, err := store.History(time.Time{}, time.Now())
+		expect.NoError(t, err)
+		expect.Equal(t, len(records), 0)
+	})
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		err = store.Append(
+			Record{Time: start.Add(time.Duration(i) * time.Hour), Service: "a.test", Healthy: true},
+			Record{Time: start.Add(time.Duration(i) * time.Hour), Service: "b.test", Healthy: i != 1},
+		)
+		expect.NoError(t, err)
+	}
+
+	t.Run("ReturnsRecordsInPeriod", func(t *testing.T) {
+		records, err := store.History(start.Add(time.Hour), start.Add(2*time.Hour))
+		expect.NoError(t, err)
+		expect.Equal(t, len(records), 2)
+		expect.Equal(t, records[1].Service, "b.test")
+		expect.Equal(t, records[1].Healthy, false)
+	})
+
+	t.Run("ReturnsAllRecords", func(t *testing.T) {
+		records, err := store.History(start, start.Add(24*time.Hour))
+		expect.NoError(t, err)
+		expect.Equal(t, len(records), 6)
+	})
+
+	t.Run("SkipsCorruptLines", func(t *testing.T) {
+		f, err := os.OpenFile(filepath.Join(store.dir, historyFile), os.O_APPEND|os.O_WRONLY, 0o640)
+		expect.NoError(t, err)
+		_, err = f.WriteString(`{"time": "2024-01-01T05:00:00Z", "serv`)
+		expect.NoError(t, err)
+		expect.NoError(t, f.Close())
+		expect.NoError(t, store.Append(Record{Time: start.Add(6 * time.Hour), Service: "a.test", Healthy: true}))
+
+		records, err := store.History(start, start.Add(24*time.Hour))
+		expect.NoError(t, err)
+		expect.Equal(t, len(records), 6)
+
+		expect.NoError(t, store.Append(Record{Time: start.Add(7 * time.Hour), Service: "a.test", Healthy: true}))
+		records, err = store.History(start, start.Add(24*time.Hour))
+		expect.NoError(t, err)
+		expect.Equal(t, len(records), 7)
+	})
+}
+
+func TestStoreHistory_SeeksPeriod(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 500; i++ {
+		expect.NoError(t, store.Append(Record{Time: start.Add(time.Duration(i) * time.Hour), Service: "a.test"}))
+	}
+
+	for _, from := range []int{0, 1, 137, 250, 498, 499, 500} {
+		records, err := store.History(start.Add(time.Duration(from)*time.Hour), start.Add(time.Duration(from+10)*time.Hour))
+		expect.NoError(t, err)
+		want := 10
+		if from+want > 500 {
+			want = 500 - from
+		}
+		expect.Equal(t, len(records), want)
+		if want > 0 {
+			expect.Equal(t, records[0].Time, start.Add(time.Duration(from)*time.Hour))
+		}
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+	expect.NoError(t, store.Prune(time.Now()))
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 72; i++ {
+		expect.NoError(t, store.Append(Record{Time: start.Add(time.Duration(i) * time.Hour), Service: "a.test"}))
+	}
+
+	// The oldest record isn't a day older than needed yet.
+	expect.NoError(t, store.Prune(start.Add(12*time.Hour)))
+	records, err := store.History(time.Time{}, start.Add(72*time.Hour))
+	expect.NoError(t, err)
+	expect.Equal(t, len(records), 72)
+
+	expect.NoError(t, store.Prune(start.Add(48*time.Hour)))
+	records, err = store.History(time.Time{}, start.Add(72*time.Hour))
+	expect.NoError(t, err)
+	expect.Equal(t, len(records), 24)
+	expect.Equal(t, records[0].Time, start.Add(48*time.Hour))
+
+	expect.NoError(t, store.Append(Record{Time: start.Add(72 * time.Hour), Service: "a.test"}))
+	records, err = store.History(time.Time{}, start.Add(73*time.Hour))
+	expect.NoError(t, err)
+	expect.Equal(t, len(records), 25)
+}
@@ -0,0 +1,100 @@
+package sermonstate
+
+import (
+	"sort"
+	"time"
+)
+
+// Stats summarizes the history of a service.
+type Stats struct {
+	Service  string
+	Checks   int
+	Failures int
+	// Incidents is the number of times the service went from healthy, or
+	// unknown, to unhealthy.
+	Incidents int
+	// Recovered is the number of incidents that were resolved, all of them
+	// but the last one if the service is still unhealthy.
+	Recovered int
+	// MTTR is the mean time to recovery of the incidents that were resolved,
+	// from the first failing check to the first passing one after it.
+	MTTR        time.Duration
+	AvgDuration time.Duration
+	// CertExpiry is the expiry of the certificate seen in the last check.
+	CertExpiry time.Time
+}
+
+// Uptime returns the percentage of passing checks.
+func (s *Stats) Uptime() float64 {
+	if s.Checks == 0 {
+		return 100
+	}
+	return float64(s.Checks-s.Failures) / float64(s.Checks) * 100
+}
+
+// Summarize computes the Stats of every service in the given records, which
+// must be sorted oldest first. Stats are sorted by service name.
+func Summarize(records []Record) []*Stats {
+	byService := map[string]*Stats{}
+	down := map[string]time.Time{}
+	totalRecovery := map[string]time.Duration{}
+	totalDuration := map[string]time.Duration{}
+
+	for _, r := range records {
+		stats, ok := byService[r.Service]
+		if !ok {
+			stats = &Stats{Service: r.Service}
+			byService[r.Service] = stats
+		}
+
+		stats.Checks++
+		totalDuration[r.Service] += time.Duration(r.DurationMs) * time.Millisecond
+		if r.CertExpiry != nil {
+			stats.CertExpiry = *r.CertExpiry
+		}
+
+		since, isDown := down[r.Service]
+		if !r.Healthy {
+			stats.Failures++
+			if !isDown {
+				stats.Incidents++
+				down[r.Service] = r.Time
+			}
+		} else if isDown {
+			totalRecovery[r.Service] += r.Time.Sub(since)
+			stats.Recovered++
+			delete(down, r.Service)
+		}
+	}
+
+	all := make([]*Stats, 0, len(byService))
+	for name, stats := range byService {
+		stats.AvgDuration = totalDuration[name] / time.Duration(stats.Checks)
+		if stats.Recovered > 0 {
+			stats.MTTR = totalRecovery[name] / time.Duration(stats.Recovered)
+		}
+		all = append(all, stats)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Service < all[j].Service
+	})
+	return all
+}
+
+// ErrorBudgetRemaining returns the percentage of the error budget allowed by
+// the given SLO that's left, it's negative if the budget is exhausted.
+func (s *Stats) ErrorBudgetRemaining(slo float64) float64 {
+	return 100 - s.BurnRate(slo)*100
+}
+
+// BurnRate returns how fast the error budget allowed by the given SLO is being
+// used up: at a burn rate of 1 it's used up exactly by the end of the period,
+// at 2 it's used up halfway through it.
+func (s *Stats) BurnRate(slo float64) float64 {
+	budget := 100 - slo
+	if budget <= 0 {
+		return 0
+	}
+	return (100 - s.Uptime()) / budget
+}
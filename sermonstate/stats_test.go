@@ -0,0 +1,65 @@
+package sermonstate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+)
+
+func TestSummarize(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	stats := Summarize([]Record{
+		{Time: at(0), Service: "b.test", Healthy: true, DurationMs: 100},
+		{Time: at(0), Service: "a.test", Healthy: true, DurationMs: 200},
+		{Time: at(10), Service: "b.test", Healthy: false, DurationMs: 300},
+		{Time: at(20), Service: "b.test", Healthy: false, DurationMs: 300},
+		{Time: at(30), Service: "b.test", Healthy: true, DurationMs: 100},
+		{Time: at(40), Service: "b.test", Healthy: false, DurationMs: 200},
+		{Time: at(50), Service: "b.test", Healthy: true, DurationMs: 200},
+		{Time: at(60), Service: "b.test", Healthy: false, DurationMs: 200},
+	})
+
+	expect.Equal(t, len(stats), 2)
+
+	a := stats[0]
+	expect.Equal(t, a.Service, "a.test")
+	expect.Equal(t, a.Checks, 1)
+	expect.Equal(t, a.Incidents, 0)
+	expect.Equal(t, a.Uptime(), float64(100))
+	expect.Equal(t, a.AvgDuration, 200*time.Millisecond)
+
+	b := stats[1]
+	expect.Equal(t, b.Service, "b.test")
+	expect.Equal(t, b.Checks, 7)
+	expect.Equal(t, b.Failures, 4)
+	expect.Equal(t, b.Incidents, 3)
+	expect.Equal(t, b.Recovered, 2)
+	// Two resolved incidents, after 20 and 10 minutes, the last one is ongoing.
+	expect.Equal(t, b.MTTR, 15*time.Minute)
+	expect.Equal(t, b.AvgDuration, 200*time.Millisecond)
+}
+
+func TestErrorBudget(t *testing.T) {
+	t.Parallel()
+	stats := &Stats{Service: "a.test", Checks: 1000, Failures: 1}
+
+	expect.Equal(t, stats.Uptime(), 99.9)
+	expect.Equal(t, round(stats.BurnRate(99.9)), 1.0)
+	expect.Equal(t, round(stats.ErrorBudgetRemaining(99.9)), 0.0)
+	expect.Equal(t, round(stats.BurnRate(99)), 0.1)
+	expect.Equal(t, round(stats.ErrorBudgetRemaining(99)), 90.0)
+	expect.Equal(t, round(stats.BurnRate(99.95)), 2.0)
+	expect.Equal(t, round(stats.ErrorBudgetRemaining(99.95)), -100.0)
+}
+
+// round rounds to 6 decimals, to compare floats.
+func round(f float64) float64 {
+	return math.Round(f*1e6) / 1e6
+}
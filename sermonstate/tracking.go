@@ -0,0 +1,120 @@
+package sermonstate
+
+import (
+	"time"
+
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+const statesFile = "state.json"
+
+// Policy is how the state of a service changes across runs.
+type Policy struct {
+	// FailThreshold is the number of consecutive failures before a service
+	// is DOWN, and RecoverThreshold the number of consecutive passes before
+	// it's UP again. Anything below 1 is taken as 1.
+	FailThreshold    int
+	RecoverThreshold int
+	// A service is FLAPPING if its checks change from passing to failing,
+	// or the other way around, FlapChanges times within FlapWindow. There's
+	// no flap detection if FlapChanges is zero.
+	FlapWindow  time.Duration
+	FlapChanges int
+}
+
+// ServiceState is the state of a service across runs.
+type ServiceState struct {
+	// Status is either UP or DOWN.
+	Status string `json:"status"`
+	// Healthy is the result of the last check.
+	Healthy bool `json:"healthy"`
+	// Failures and Passes are the number of consecutive failing and passing
+	// checks.
+	Failures int `json:"failures"`
+	Passes   int `json:"passes"`
+	// Changes are the times the result of the checks changed, within the
+	// flap window.
+	Changes  []time.Time `json:"changes,omitempty"`
+	Flapping bool        `json:"flapping"`
+}
+
+// Update updates the state with the result of a check made at time t.
+func (s *ServiceState) Update(healthy bool, t time.Time, p Policy) {
+	if s.Status != "" && healthy != s.Healthy {
+		s.Changes = append(s.Changes, t)
+	}
+	s.Healthy = healthy
+
+	if healthy {
+		s.Passes++
+		s.Failures = 0
+	} else {
+		s.Failures++
+		s.Passes = 0
+	}
+
+	if s.Status == "" {
+		s.Status = sermoncore.StateUp
+	}
+	if s.Status == sermoncore.StateUp && s.Failures >= atLeastOne(p.FailThreshold) {
+		s.Status = sermoncore.StateDown
+	} else if s.Status == sermoncore.StateDown && s.Passes >= atLeastOne(p.RecoverThreshold) {
+		s.Status = sermoncore.StateUp
+	}
+
+	if p.FlapChanges == 0 {
+		s.Changes = nil
+		s.Flapping = false
+		return
+	}
+
+	since := t.Add(-p.FlapWindow)
+	recent := s.Changes[:0]
+	for _, c := range s.Changes {
+		if c.After(since) {
+			recent = append(recent, c)
+		}
+	}
+	s.Changes = recent
+	s.Flapping = len(s.Changes) >= p.FlapChanges
+}
+
+// State returns the state to report: FLAPPING, UP or DOWN.
+func (s *ServiceState) State() string {
+	if s.Flapping {
+		return sermoncore.StateFlapping
+	}
+	return s.Status
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// States returns the state of every service, by name.
+func (s *Store) States() (map[string]*ServiceState, error) {
+	states := map[string]*ServiceState{}
+	err := s.locked(statesFile, func() error {
+		return s.readJSON(statesFile, &states)
+	})
+	return states, err
+}
+
+// UpdateStates updates the state of every service, by name, with fn. Nothing
+// is saved if fn fails. The states are locked, across processes too, while fn
+// runs, so it should be quick.
+func (s *Store) UpdateStates(fn func(states map[string]*ServiceState) error) error {
+	return s.locked(statesFile, func() error {
+		states := map[string]*ServiceState{}
+		if err := s.readJSON(statesFile, &states); err != nil {
+			return err
+		}
+		if err := fn(states); err != nil {
+			return err
+		}
+		return s.writeJSON(statesFile, states)
+	})
+}
@@ -0,0 +1,108 @@
+package sermonstate
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/germandv/sermon/expect"
+	"gitlab.com/germandv/sermon/sermoncore"
+)
+
+func TestUpdate_Thresholds(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := Policy{FailThreshold: 3, RecoverThreshold: 2}
+	state := &ServiceState{}
+
+	checks := []struct {
+		healthy bool
+		state   string
+	}{
+		{true, sermoncore.StateUp},
+		{false, sermoncore.StateUp},
+		{false, sermoncore.StateUp},
+		{true, sermoncore.StateUp},
+		{false, sermoncore.StateUp},
+		{false, sermoncore.StateUp},
+		{false, sermoncore.StateDown},
+		{true, sermoncore.StateDown},
+		{false, sermoncore.StateDown},
+		{true, sermoncore.StateDown},
+		{true, sermoncore.StateUp},
+	}
+
+	for i, c := range checks {
+		state.Update(c.healthy, start.Add(time.Duration(i)*time.Minute), policy)
+		if state.State() != c.state {
+			t.Fatalf("check %d: want %s, got %s", i, c.state, state.State())
+		}
+	}
+}
+
+func TestUpdate_DefaultThresholds(t *testing.T) {
+	t.Parallel()
+	state := &ServiceState{}
+
+	state.Update(false, time.Now(), Policy{})
+	expect.Equal(t, state.State(), sermoncore.StateDown)
+
+	state.Update(true, time.Now(), Policy{})
+	expect.Equal(t, state.State(), sermoncore.StateUp)
+}
+
+func TestUpdate_Flapping(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := Policy{FlapWindow: 30 * time.Minute, FlapChanges: 3}
+	state := &ServiceState{}
+
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+
+	state.Update(true, at(0), policy)
+	state.Update(false, at(5), policy)
+	state.Update(true, at(10), policy)
+	expect.Equal(t, state.State(), sermoncore.StateUp)
+
+	state.Update(false, at(15), policy)
+	expect.Equal(t, state.State(), sermoncore.StateFlapping)
+
+	// The first changes fall out of the window.
+	state.Update(false, at(40), policy)
+	expect.Equal(t, state.State(), sermoncore.StateDown)
+	expect.Equal(t, len(state.Changes), 1)
+}
+
+func TestStoreStates(t *testing.T) {
+	t.Parallel()
+	store, err := Open(filepath.Join(t.TempDir(), "state"))
+	expect.NoError(t, err)
+
+	states, err := store.States()
+	expect.NoError(t, err)
+	expect.Equal(t, len(states), 0)
+
+	err = store.UpdateStates(func(states map[string]*ServiceState) error {
+		states["a.test"] = &ServiceState{Status: sermoncore.StateDown, Failures: 2}
+		return nil
+	})
+	expect.NoError(t, err)
+
+	err = store.UpdateStates(func(states map[string]*ServiceState) error {
+		states["a.test"].Failures++
+		return errors.New("boom")
+	})
+	expect.Equal(t, err.Error(), "boom")
+
+	states, err = store.States()
+	expect.NoError(t, err)
+	expect.Equal(t, states["a.test"].Status, sermoncore.StateDown)
+	expect.Equal(t, states["a.test"].Failures, 2)
+
+	matches, err := filepath.Glob(filepath.Join(store.dir, "*.tmp"))
+	expect.NoError(t, err)
+	expect.Equal(t, len(matches), 0)
+}